@@ -0,0 +1,92 @@
+package memoria
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ReadResult is the value of a key read by BulkRead, or the error reading it
+type ReadResult struct {
+	Key   string
+	Value []byte
+	Error error
+}
+
+// runWorkers calls task with every index below n from numWorkers goroutines and returns
+// the errors by index. numWorkers <= 0 starts one worker per CPU. Once ctx is done the
+// workers start no new tasks, those fail with ErrNotAttempted
+func runWorkers(ctx context.Context, n int, numWorkers int, task func(i int) error) []error {
+	errs := make([]error, n)
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+	numWorkers = min(numWorkers, n)
+
+	// workers take the next index until every task is taken
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				if err := ctx.Err(); err != nil {
+					errs[i] = notAttempted(err)
+					continue
+				}
+				errs[i] = task(i)
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// BulkRead reads the keys using numWorkers goroutines and returns their values in the
+// order of keys. Every key read from disk is cached like a Read, so BulkRead warms the
+// cache. numWorkers <= 0 uses one worker per CPU
+func (m *Memoria) BulkRead(keys []string, numWorkers int) []ReadResult {
+	return m.BulkReadCtx(context.Background(), keys, numWorkers)
+}
+
+// BulkReadCtx is BulkRead which stops once ctx is done, see ReadCtx. The keys which were
+// never read are reported with ErrNotAttempted
+func (m *Memoria) BulkReadCtx(ctx context.Context, keys []string, numWorkers int) []ReadResult {
+	results := make([]ReadResult, len(keys))
+	errs := runWorkers(ctx, len(keys), numWorkers, func(i int) error {
+		val, err := m.ReadCtx(ctx, keys[i])
+		results[i].Value = val
+		return err
+	})
+	for i, key := range keys {
+		results[i].Key = key
+		results[i].Error = errs[i]
+	}
+	return results
+}
+
+// BulkErase erases the keys using numWorkers goroutines and returns the results in the
+// order of keys. Missing keys fail with ErrKeyNotFound like Erase. numWorkers <= 0 uses
+// one worker per CPU
+func (m *Memoria) BulkErase(keys []string, numWorkers int) []WriteResult {
+	return m.BulkEraseCtx(context.Background(), keys, numWorkers)
+}
+
+// BulkEraseCtx is BulkErase which stops once ctx is done. The keys which were never
+// erased are reported with ErrNotAttempted
+func (m *Memoria) BulkEraseCtx(ctx context.Context, keys []string, numWorkers int) []WriteResult {
+	errs := runWorkers(ctx, len(keys), numWorkers, func(i int) error {
+		return m.Erase(keys[i])
+	})
+	results := make([]WriteResult, len(keys))
+	for i, key := range keys {
+		results[i] = WriteResult{Key: key, Error: errs[i]}
+	}
+	return results
+}
@@ -1,6 +1,10 @@
 package memoria
 
-import "fmt"
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
 
 // implement here the different cache types here
 type CachePolicy interface {
@@ -8,6 +12,16 @@ type CachePolicy interface {
 	Insert(m *Memoria, key string, val []byte) error
 }
 
+// CacheObserver is an optional interface for cache policies which keep their own
+// bookkeeping of the cached keys. Hit is called whenever a read is served from the cache
+// and Remove whenever a key leaves the cache other than through Eject, for example
+// when it is overwritten or erased. Every method of a policy is called while the
+// cache's mutex is held
+type CacheObserver interface {
+	Hit(m *Memoria, key string)
+	Remove(m *Memoria, key string)
+}
+
 type defaultCachePolicy struct{}
 
 func (dc *defaultCachePolicy) Eject(m *Memoria, requriedSpace uint64) error {
@@ -33,3 +47,388 @@ func (dc *defaultCachePolicy) Insert(m *Memoria, key string, val []byte) error {
 	m.cacheSize += valueSize
 	return nil
 }
+
+// LRUCachePolicy ejects the least recently used keys first. Both hits and inserts
+// are O(1). A policy keeps state about the cache so it must not be shared between stores
+type LRUCachePolicy struct {
+	mu    sync.Mutex
+	order *list.List // most recently used key at the front
+	items map[string]*list.Element
+}
+
+// NewLRUCachePolicy returns an empty LRUCachePolicy
+func NewLRUCachePolicy() *LRUCachePolicy {
+	return &LRUCachePolicy{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (lru *LRUCachePolicy) Eject(m *Memoria, requriedSpace uint64) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	spaceFreed := uint64(0)
+	for spaceFreed < requriedSpace {
+		e := lru.order.Back()
+		if e == nil {
+			break
+		}
+		key := e.Value.(string)
+		lru.order.Remove(e)
+		delete(lru.items, key)
+
+		if val, ok := m.cache[key]; ok {
+			valSize := uint64(len(val))
+			m.cacheSize -= valSize
+			delete(m.cache, key)
+			spaceFreed += valSize
+		}
+	}
+	return nil
+}
+
+func (lru *LRUCachePolicy) Insert(m *Memoria, key string, val []byte) error {
+	valueSize := uint64(len(val))
+	if m.cacheSize+valueSize > m.MaxCacheSize {
+		return fmt.Errorf("LRUCachePolicy: Failded to make room for value (%d/%d)", valueSize, m.MaxCacheSize)
+	}
+
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	m.cache[key] = val
+	m.cacheSize += valueSize
+	if e, ok := lru.items[key]; ok {
+		lru.order.MoveToFront(e)
+		return nil
+	}
+	lru.items[key] = lru.order.PushFront(key)
+	return nil
+}
+
+func (lru *LRUCachePolicy) Hit(m *Memoria, key string) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if e, ok := lru.items[key]; ok {
+		lru.order.MoveToFront(e)
+	}
+}
+
+func (lru *LRUCachePolicy) Remove(m *Memoria, key string) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if e, ok := lru.items[key]; ok {
+		lru.order.Remove(e)
+		delete(lru.items, key)
+	}
+}
+
+// LFUCachePolicy ejects the least frequently used keys first, breaking ties by ejecting
+// the least recently used of them. Keys are kept in buckets of equal hit count so hits,
+// inserts and ejections are all O(1)
+type LFUCachePolicy struct {
+	mu      sync.Mutex
+	buckets *list.List // of *lfuBucket in increasing order of freq
+	items   map[string]*lfuEntry
+}
+
+type lfuBucket struct {
+	freq uint64
+	keys *list.List // most recently used key at the front
+}
+
+type lfuEntry struct {
+	bucket *list.Element // element of LFUCachePolicy.buckets
+	elem   *list.Element // element of lfuBucket.keys
+}
+
+// NewLFUCachePolicy returns an empty LFUCachePolicy
+func NewLFUCachePolicy() *LFUCachePolicy {
+	return &LFUCachePolicy{
+		buckets: list.New(),
+		items:   make(map[string]*lfuEntry),
+	}
+}
+
+func (lfu *LFUCachePolicy) Eject(m *Memoria, requriedSpace uint64) error {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	spaceFreed := uint64(0)
+	for spaceFreed < requriedSpace {
+		front := lfu.buckets.Front()
+		if front == nil {
+			break
+		}
+		key := front.Value.(*lfuBucket).keys.Back().Value.(string)
+		lfu.remove(key)
+
+		if val, ok := m.cache[key]; ok {
+			valSize := uint64(len(val))
+			m.cacheSize -= valSize
+			delete(m.cache, key)
+			spaceFreed += valSize
+		}
+	}
+	return nil
+}
+
+func (lfu *LFUCachePolicy) Insert(m *Memoria, key string, val []byte) error {
+	valueSize := uint64(len(val))
+	if m.cacheSize+valueSize > m.MaxCacheSize {
+		return fmt.Errorf("LFUCachePolicy: Failded to make room for value (%d/%d)", valueSize, m.MaxCacheSize)
+	}
+
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	m.cache[key] = val
+	m.cacheSize += valueSize
+	if _, ok := lfu.items[key]; ok {
+		lfu.touch(key)
+		return nil
+	}
+
+	front := lfu.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = lfu.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+	lfu.items[key] = &lfuEntry{
+		bucket: front,
+		elem:   front.Value.(*lfuBucket).keys.PushFront(key),
+	}
+	return nil
+}
+
+func (lfu *LFUCachePolicy) Hit(m *Memoria, key string) {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	if _, ok := lfu.items[key]; ok {
+		lfu.touch(key)
+	}
+}
+
+func (lfu *LFUCachePolicy) Remove(m *Memoria, key string) {
+	lfu.mu.Lock()
+	defer lfu.mu.Unlock()
+
+	if _, ok := lfu.items[key]; ok {
+		lfu.remove(key)
+	}
+}
+
+// touch moves the key into the bucket of the next frequency
+func (lfu *LFUCachePolicy) touch(key string) {
+	entry := lfu.items[key]
+	current := entry.bucket.Value.(*lfuBucket)
+
+	next := entry.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != current.freq+1 {
+		next = lfu.buckets.InsertAfter(&lfuBucket{freq: current.freq + 1, keys: list.New()}, entry.bucket)
+	}
+
+	current.keys.Remove(entry.elem)
+	if current.keys.Len() == 0 {
+		lfu.buckets.Remove(entry.bucket)
+	}
+	entry.bucket = next
+	entry.elem = next.Value.(*lfuBucket).keys.PushFront(key)
+}
+
+func (lfu *LFUCachePolicy) remove(key string) {
+	entry := lfu.items[key]
+	bucket := entry.bucket.Value.(*lfuBucket)
+	bucket.keys.Remove(entry.elem)
+	if bucket.keys.Len() == 0 {
+		lfu.buckets.Remove(entry.bucket)
+	}
+	delete(lfu.items, key)
+}
+
+// ARCCachePolicy is an Adaptive Replacement Cache. Keys seen once are kept in a recency
+// list and keys hit again are promoted to a frequency list. Keys ejected from either list
+// are remembered in ghost lists and a later miss on a ghost shifts the target size of the
+// recency list towards the list that would have kept it. Sizes are measured in bytes
+type ARCCachePolicy struct {
+	mu     sync.Mutex
+	target uint64 // target size of t1 in bytes
+	t1     *arcList
+	t2     *arcList
+	b1     *arcList // keys ejected from t1
+	b2     *arcList // keys ejected from t2
+}
+
+// arcList is an LRU list of keys which keeps track of the total size of its values
+type arcList struct {
+	order *list.List // of *arcEntry, most recently used at the front
+	items map[string]*list.Element
+	size  uint64
+}
+
+type arcEntry struct {
+	key  string
+	size uint64
+}
+
+func newARCList() *arcList {
+	return &arcList{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *arcList) has(key string) bool {
+	_, ok := l.items[key]
+	return ok
+}
+
+func (l *arcList) pushFront(key string, size uint64) {
+	l.items[key] = l.order.PushFront(&arcEntry{key: key, size: size})
+	l.size += size
+}
+
+func (l *arcList) remove(key string) (*arcEntry, bool) {
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := l.order.Remove(e).(*arcEntry)
+	delete(l.items, key)
+	l.size -= entry.size
+	return entry, true
+}
+
+// removeBack removes the least recently used key
+func (l *arcList) removeBack() (*arcEntry, bool) {
+	e := l.order.Back()
+	if e == nil {
+		return nil, false
+	}
+	return l.remove(e.Value.(*arcEntry).key)
+}
+
+// NewARCCachePolicy returns an empty ARCCachePolicy
+func NewARCCachePolicy() *ARCCachePolicy {
+	return &ARCCachePolicy{
+		t1: newARCList(),
+		t2: newARCList(),
+		b1: newARCList(),
+		b2: newARCList(),
+	}
+}
+
+func (arc *ARCCachePolicy) Eject(m *Memoria, requriedSpace uint64) error {
+	arc.mu.Lock()
+	defer arc.mu.Unlock()
+
+	spaceFreed := uint64(0)
+	for spaceFreed < requriedSpace {
+		// eject from the recency list while it is above its target size
+		var entry *arcEntry
+		var ok bool
+		if arc.t1.size > 0 && (arc.t1.size > arc.target || arc.t2.size == 0) {
+			if entry, ok = arc.t1.removeBack(); ok {
+				arc.b1.pushFront(entry.key, entry.size)
+			}
+		} else {
+			if entry, ok = arc.t2.removeBack(); ok {
+				arc.b2.pushFront(entry.key, entry.size)
+			}
+		}
+		if !ok {
+			break
+		}
+
+		if val, ok := m.cache[entry.key]; ok {
+			valSize := uint64(len(val))
+			m.cacheSize -= valSize
+			delete(m.cache, entry.key)
+			spaceFreed += valSize
+		}
+	}
+	arc.trimGhosts(m.MaxCacheSize)
+	return nil
+}
+
+func (arc *ARCCachePolicy) Insert(m *Memoria, key string, val []byte) error {
+	valueSize := uint64(len(val))
+	if m.cacheSize+valueSize > m.MaxCacheSize {
+		return fmt.Errorf("ARCCachePolicy: Failded to make room for value (%d/%d)", valueSize, m.MaxCacheSize)
+	}
+
+	arc.mu.Lock()
+	defer arc.mu.Unlock()
+
+	m.cache[key] = val
+	m.cacheSize += valueSize
+
+	arc.t1.remove(key)
+	arc.t2.remove(key)
+
+	switch {
+	case arc.b1.has(key):
+		// a miss on a key recently ejected from t1, t1 should have been larger
+		delta := valueSize
+		if arc.b1.size > 0 && arc.b2.size > arc.b1.size {
+			delta *= arc.b2.size / arc.b1.size
+		}
+		arc.target = min(arc.target+delta, m.MaxCacheSize)
+		arc.b1.remove(key)
+		arc.t2.pushFront(key, valueSize)
+	case arc.b2.has(key):
+		// a miss on a key recently ejected from t2, t2 should have been larger
+		delta := valueSize
+		if arc.b2.size > 0 && arc.b1.size > arc.b2.size {
+			delta *= arc.b1.size / arc.b2.size
+		}
+		if delta > arc.target {
+			delta = arc.target
+		}
+		arc.target -= delta
+		arc.b2.remove(key)
+		arc.t2.pushFront(key, valueSize)
+	default:
+		arc.t1.pushFront(key, valueSize)
+	}
+
+	arc.trimGhosts(m.MaxCacheSize)
+	return nil
+}
+
+func (arc *ARCCachePolicy) Hit(m *Memoria, key string) {
+	arc.mu.Lock()
+	defer arc.mu.Unlock()
+
+	// a second hit promotes the key to the frequency list
+	if entry, ok := arc.t1.remove(key); ok {
+		arc.t2.pushFront(entry.key, entry.size)
+		return
+	}
+	if entry, ok := arc.t2.remove(key); ok {
+		arc.t2.pushFront(entry.key, entry.size)
+	}
+}
+
+func (arc *ARCCachePolicy) Remove(m *Memoria, key string) {
+	arc.mu.Lock()
+	defer arc.mu.Unlock()
+
+	arc.t1.remove(key)
+	arc.t2.remove(key)
+}
+
+// trimGhosts bounds the ghost lists the way ARC bounds them by entries: t1 and b1
+// together never exceed the cache size and all four lists never exceed twice the size
+func (arc *ARCCachePolicy) trimGhosts(maxSize uint64) {
+	for arc.t1.size+arc.b1.size > maxSize {
+		if _, ok := arc.b1.removeBack(); !ok {
+			break
+		}
+	}
+	for arc.t1.size+arc.t2.size+arc.b1.size+arc.b2.size > 2*maxSize {
+		if _, ok := arc.b2.removeBack(); !ok {
+			break
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package memoria
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+)
+
+// ErrCorrupt is returned when a value does not match its checksum
+var ErrCorrupt = errors.New("value is corrupt")
+
+// checksumMagic starts the header of checksummed values. The header is followed by the
+// CRC-32C of the uncompressed value and then by the value as it is otherwise stored. It
+// is only looked for by stores with Checksum
+var checksumMagic = []byte{0x00, 'M', 'C', 'S'}
+
+const checksumHeaderSize = 8
+
+// writeChecksumHeader reserves the header of a checksummed value in f, the checksum
+// itself is written by finishChecksum once the value is complete
+func writeChecksumHeader(f io.Writer) error {
+	_, err := f.Write(append(append([]byte{}, checksumMagic...), 0, 0, 0, 0))
+	return err
+}
+
+// finishChecksum writes the checksum into the header of f
+func finishChecksum(f io.WriterAt, checksum hash.Hash32) error {
+	_, err := f.WriteAt(binary.LittleEndian.AppendUint32(nil, checksum.Sum32()), int64(len(checksumMagic)))
+	return err
+}
+
+// valueReader returns a reader of the uncompressed value stored in r. Checksummed values
+// are verified as they are read, the reader fails with ErrCorrupt instead of returning
+// io.EOF when the value does not match. Values without a checksum are read as they are.
+// Stores without Checksum never look for the header, so their values may start with
+// anything
+func (m *Memoria) valueReader(r io.Reader, key string) (io.Reader, error) {
+	if !m.Checksum {
+		return m.decompressReader(r)
+	}
+	br := bufio.NewReader(r)
+	header, err := br.Peek(checksumHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) < checksumHeaderSize || !bytes.Equal(header[:len(checksumMagic)], checksumMagic) {
+		return m.decompressReader(br)
+	}
+
+	want := binary.LittleEndian.Uint32(header[len(checksumMagic):])
+	br.Discard(checksumHeaderSize)
+	dr, err := m.decompressReader(br)
+	if err != nil {
+		return nil, corruptError(key, err)
+	}
+	return &checksumReader{r: dr, crc: crc32.New(crcTable), want: want, key: key}, nil
+}
+
+// checksumReader verifies the checksum of a value once it has been read to the end
+type checksumReader struct {
+	r    io.Reader
+	crc  hash.Hash32
+	want uint32
+	key  string
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc.Write(p[:n])
+	if err == io.EOF && c.crc.Sum32() != c.want {
+		return n, fmt.Errorf("%w: %s: checksum %08x, want %08x", ErrCorrupt, c.key, c.crc.Sum32(), c.want)
+	}
+	if err != nil && err != io.EOF {
+		return n, corruptError(c.key, err)
+	}
+	return n, err
+}
+
+// corruptError wraps the errors of decompressors reading damaged data with ErrCorrupt
+func corruptError(key string, err error) error {
+	var flateErr flate.CorruptInputError
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, gzip.ErrChecksum), errors.Is(err, gzip.ErrHeader),
+		errors.Is(err, zlib.ErrChecksum), errors.Is(err, zlib.ErrHeader), errors.As(err, &flateErr):
+		return fmt.Errorf("%w: %s: %s", ErrCorrupt, key, err)
+	}
+	return err
+}
+
+// Verify reads the value of the key from disk and checks it against its checksum. It
+// returns an error wrapping ErrCorrupt when they do not match, values written without
+// a checksum, and every value of a store without Checksum, always verify
+func (m *Memoria) Verify(key string) error {
+	if len(key) <= 0 {
+		return fmt.Errorf("Empty key")
+	}
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	f, err := m.openValue(pathKey)
+	m.mu.RUnlock()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		return err
+	}
+	defer f.Close()
+
+	return m.verifyValue(f, key)
+}
+
+// verifyValue reads the value stored in r to the end
+func (m *Memoria) verifyValue(r io.Reader, key string) error {
+	vr, err := m.valueReader(r, key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, vr)
+	return err
+}
+
+// Scrub verifies every value in the store and returns the keys which are corrupt. It
+// stops at the first error other than a corrupt value
+func (m *Memoria) Scrub() ([]string, error) {
+	corrupt := []string{}
+	err := m.walkKeyFiles(func(key, path string) error {
+		m.mu.RLock()
+		f, err := m.openKeyFile(path)
+		m.mu.RUnlock()
+		if err == nil {
+			err = m.verifyValue(f, key)
+			f.Close()
+		}
+		switch {
+		case errors.Is(err, ErrCorrupt):
+			corrupt = append(corrupt, key)
+		case errors.Is(err, fs.ErrNotExist):
+			// the key was erased since it was listed
+		case err != nil:
+			return err
+		}
+		return nil
+	})
+	return corrupt, err
+}
+
+// verifyKeyFile verifies the value of the key file at path, the caller must hold the
+// store's mutex
+func (m *Memoria) verifyKeyFile(key, path string) error {
+	f, err := m.openKeyFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return m.verifyValue(f, key)
+}
+
+// openKeyFile opens the file holding the value of the key file at path
+func (m *Memoria) openKeyFile(path string) (File, error) {
+	source, err := m.valueFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.FS.Open(source)
+	if err != nil && source != path {
+		return nil, missingBlob(err, path)
+	}
+	return f, err
+}
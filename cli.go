@@ -1,3 +0,0 @@
-package memoria
-
-// add code for cli
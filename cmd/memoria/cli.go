@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3
+)
+
+const usage = `usage: memoria [--dir DIR] [--compression gzip|zlib|flate] [--transform T] [--checksum]
+               [--content-addressed] <command> [arguments]
+
+The options describe how the store was written and must match it. --transform is
+plain, escaped, sharded:WIDTH:DEPTH or hashed:WIDTH:DEPTH, plain by default.
+
+commands:
+  get <key>            print the value of key
+  put <key> [value]    write value, or stdin when no value is given, to key
+  append <key> [value] append value, or stdin when no value is given, to key
+  rm <key>             erase key
+  ls [--prefix P]      list the keys, one per line
+  stat <key>           print the size of the value of key
+  dump                 write a snapshot of the store to stdout
+  restore              restore a snapshot written by dump from stdin
+  fsck [--repair] [--quarantine-bad-keys]
+                       check the store for damage left by crashes, and repair it.
+                       Files which do not map back to a key are only moved to
+                       lost+found with --quarantine-bad-keys
+`
+
+// cli holds the store and the streams a command works with
+type cli struct {
+	m      *memoria.Memoria
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// usageError is returned by commands called with the wrong arguments
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+// run parses the arguments, runs the command and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("memoria", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	dir := flags.String("dir", "memoria", "base directory of the store")
+	compression := flags.String("compression", "", "compression of the store: gzip, zlib or flate")
+	transform := flags.String("transform", "plain", "path transform of the store: plain, escaped, sharded:WIDTH:DEPTH or hashed:WIDTH:DEPTH")
+	checksum := flags.Bool("checksum", false, "the store keeps a checksum with every value")
+	contentAddressed := flags.Bool("content-addressed", false, "the store keeps identical values once")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	opts := memoria.Options{Basedir: *dir, Checksum: *checksum, ContentAddressed: *contentAddressed}
+	switch *compression {
+	case "":
+	case "gzip":
+		opts.Compression = memoria.NewGzipCompression()
+	case "zlib":
+		opts.Compression = memoria.NewZlibCompression()
+	case "flate":
+		opts.Compression = memoria.NewFlateCompression()
+	default:
+		fmt.Fprintf(stderr, "memoria: unknown compression %q\n", *compression)
+		return exitUsage
+	}
+	if err := parseTransform(*transform, &opts); err != nil {
+		fmt.Fprintf(stderr, "memoria: %s\n", err)
+		return exitUsage
+	}
+
+	// the store is locked so the tool fails with ErrStoreLocked instead of writing
+	// past a process holding it
+	switch flags.Arg(0) {
+	case "fsck":
+		// nothing else may write the store while it is checked
+		opts.Lock = memoria.LockExclusive
+	case "get", "ls", "stat", "dump":
+		opts.Lock = memoria.LockReadOnly
+	default:
+		opts.Lock = memoria.LockSingleWriter
+	}
+
+	m, err := memoria.Open(opts)
+	if errors.Is(err, errors.ErrUnsupported) {
+		// platforms without file locks can only open the store unlocked
+		opts.Lock = memoria.LockNone
+		m, err = memoria.Open(opts)
+	}
+	if err != nil {
+		return exitCode(err, stderr)
+	}
+	defer m.Close()
+
+	c := &cli{m: m, stdin: stdin, stdout: stdout}
+
+	cmd, cmdArgs := flags.Arg(0), flags.Args()[1:]
+	switch cmd {
+	case "get":
+		err = c.get(cmdArgs)
+	case "put":
+		err = c.put(cmdArgs, false)
+	case "append":
+		err = c.put(cmdArgs, true)
+	case "rm":
+		err = c.rm(cmdArgs)
+	case "ls":
+		err = c.ls(cmdArgs, stderr)
+	case "stat":
+		err = c.stat(cmdArgs)
+	case "dump":
+		err = c.dump(cmdArgs)
+	case "restore":
+		err = c.restore(cmdArgs)
+	case "fsck":
+		err = c.fsck(cmdArgs, stderr)
+	default:
+		err = &usageError{fmt.Sprintf("unknown command %q", cmd)}
+	}
+
+	return exitCode(err, stderr)
+}
+
+// parseTransform sets the path transform named by s in opts
+func parseTransform(s string, opts *memoria.Options) error {
+	name, args, _ := strings.Cut(s, ":")
+	switch name {
+	case "plain":
+		if args == "" {
+			return nil
+		}
+	case "escaped":
+		if args == "" {
+			opts.PathTransform, opts.InversePathTransform = memoria.EscapedTransform()
+			return nil
+		}
+	case "sharded", "hashed":
+		w, d, ok := strings.Cut(args, ":")
+		width, werr := strconv.Atoi(w)
+		depth, derr := strconv.Atoi(d)
+		if !ok || werr != nil || derr != nil || width <= 0 || depth <= 0 {
+			break
+		}
+		if name == "sharded" {
+			opts.PathTransform, opts.InversePathTransform = memoria.ShardedTransform(width, depth)
+		} else {
+			opts.PathTransform, opts.InversePathTransform = memoria.HashedTransform(width, depth)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown transform %q", s)
+}
+
+// exitCode reports err on stderr and maps it to the exit code of the command
+func exitCode(err error, stderr io.Writer) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "memoria: %s\n", err)
+
+	var ue *usageError
+	switch {
+	case errors.As(err, &ue):
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	case errors.Is(err, memoria.ErrKeyNotFound):
+		return exitNotFound
+	default:
+		return exitError
+	}
+}
+
+func (c *cli) get(args []string) error {
+	if len(args) != 1 {
+		return &usageError{"get takes exactly one key"}
+	}
+	rc, err := c.m.ReadStream(args[0], false)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(c.stdout, rc)
+	return err
+}
+
+func (c *cli) put(args []string, append bool) error {
+	var r io.Reader
+	switch len(args) {
+	case 1:
+		r = c.stdin
+	case 2:
+		r = strings.NewReader(args[1])
+	default:
+		return &usageError{"put and append take a key and an optional value"}
+	}
+	return c.m.WriteStream(args[0], r, append, true)
+}
+
+func (c *cli) rm(args []string) error {
+	if len(args) != 1 {
+		return &usageError{"rm takes exactly one key"}
+	}
+	return c.m.Erase(args[0])
+}
+
+func (c *cli) ls(args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	prefix := flags.String("prefix", "", "only list keys starting with prefix")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{err.Error()}
+	}
+	if flags.NArg() != 0 {
+		return &usageError{"ls takes no arguments"}
+	}
+
+	w := bufio.NewWriter(c.stdout)
+	cancel := make(chan struct{})
+	defer close(cancel)
+	for key := range c.m.KeysPrefix(*prefix, cancel) {
+		if _, err := fmt.Fprintln(w, key); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func (c *cli) stat(args []string) error {
+	if len(args) != 1 {
+		return &usageError{"stat takes exactly one key"}
+	}
+	rc, err := c.m.ReadStream(args[0], true)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	size, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.stdout, "%s\t%d\n", args[0], size)
+	return err
+}
+
+// dump writes a snapshot of the store to stdout
+func (c *cli) dump(args []string) error {
+	if len(args) != 0 {
+		return &usageError{"dump takes no arguments"}
+	}
+	return c.m.Snapshot(c.stdout)
+}
+
+// restore writes every key of a snapshot read from stdin into the store
+func (c *cli) restore(args []string) error {
+	if len(args) != 0 {
+		return &usageError{"restore takes no arguments"}
+	}
+	return c.m.Restore(c.stdin)
+}
+
+// fsck prints the problems found in the store and a summary. It fails when problems
+// are left unrepaired
+func (c *cli) fsck(args []string, stderr io.Writer) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	repair := flags.Bool("repair", false, "remove temp files and empty directories and move corrupt values to lost+found")
+	quarantine := flags.Bool("quarantine-bad-keys", false, "with --repair, also move files which do not map back to a key to lost+found")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{err.Error()}
+	}
+	if flags.NArg() != 0 {
+		return &usageError{"fsck takes no arguments"}
+	}
+	if *quarantine && !*repair {
+		return &usageError{"--quarantine-bad-keys needs --repair"}
+	}
+
+	// bad keys are usually the keys of a store opened with the wrong --transform, so
+	// they are only moved away on request
+	ctx := context.Background()
+	var report *memoria.CheckReport
+	var err error
+	switch {
+	case *quarantine:
+		report, err = c.m.Repair(ctx)
+	case *repair:
+		report, err = c.m.RepairKinds(ctx, memoria.ProblemTempFile, memoria.ProblemEmptyFile, memoria.ProblemEmptyDir,
+			memoria.ProblemCorrupt, memoria.ProblemOrphanExpiry)
+	default:
+		report, err = c.m.Check(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(c.stdout)
+	for _, p := range report.Problems {
+		fmt.Fprintln(w, p)
+	}
+	repaired := len(report.Problems) - report.Unrepaired()
+	fmt.Fprintf(w, "checked %d keys: %d problems, %d repaired\n", report.Keys, len(report.Problems), repaired)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if n := report.Unrepaired(); n > 0 {
+		if *repair && !*quarantine && report.Count(memoria.ProblemBadKey) > 0 {
+			return fmt.Errorf("%d problems left, bad keys are kept: check that --transform matches the store, or add --quarantine-bad-keys", n)
+		}
+		return fmt.Errorf("%d problems left, run fsck --repair to fix them", n)
+	}
+	return nil
+}
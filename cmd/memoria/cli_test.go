@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		wantCode int
+		wantOut  string
+	}{
+		{name: "put from argument", args: []string{"put", "a", "hello"}, wantCode: exitOK},
+		{name: "put from stdin", args: []string{"put", "b"}, stdin: "from stdin", wantCode: exitOK},
+		{name: "append", args: []string{"append", "a", " world"}, wantCode: exitOK},
+		{name: "get", args: []string{"get", "a"}, wantCode: exitOK, wantOut: "hello world"},
+		{name: "get from stdin value", args: []string{"get", "b"}, wantCode: exitOK, wantOut: "from stdin"},
+		{name: "stat", args: []string{"stat", "a"}, wantCode: exitOK, wantOut: "a\t11\n"},
+		{name: "ls", args: []string{"ls"}, wantCode: exitOK, wantOut: "a\nb\n"},
+		{name: "ls with prefix", args: []string{"ls", "--prefix", "b"}, wantCode: exitOK, wantOut: "b\n"},
+		{name: "rm", args: []string{"rm", "a"}, wantCode: exitOK},
+		{name: "get missing key", args: []string{"get", "a"}, wantCode: exitNotFound},
+		{name: "rm missing key", args: []string{"rm", "a"}, wantCode: exitNotFound},
+		{name: "stat missing key", args: []string{"stat", "a"}, wantCode: exitNotFound},
+		{name: "unknown command", args: []string{"frobnicate"}, wantCode: exitUsage},
+		{name: "get without key", args: []string{"get"}, wantCode: exitUsage},
+		{name: "no command", args: []string{}, wantCode: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"--dir", dir}, tt.args...)
+			code := run(args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Errorf("run() exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr.String())
+			}
+			if tt.wantOut != "" && stdout.String() != tt.wantOut {
+				t.Errorf("run() stdout = %q, want %q", stdout.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestCLIDumpRestore(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	var stdout, stderr bytes.Buffer
+
+	for _, kv := range [][]string{{"a", "first"}, {"b", "second"}} {
+		if code := run([]string{"--dir", src, "put", kv[0], kv[1]}, nil, &stdout, &stderr); code != exitOK {
+			t.Fatalf("put exit code = %d (stderr: %s)", code, stderr.String())
+		}
+	}
+
+	if code := run([]string{"--dir", src, "dump"}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("dump exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	dump := stdout.String()
+
+	if code := run([]string{"--dir", dst, "restore"}, strings.NewReader(dump), &stdout, &stderr); code != exitOK {
+		t.Fatalf("restore exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"--dir", dst, "get", "b"}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("get exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if stdout.String() != "second" {
+		t.Errorf("get after restore = %q, want %q", stdout.String(), "second")
+	}
+}
+
+func TestCLIFsck(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--dir", dir, "put", "a", "value"}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("put exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	// a temp file left behind by a crashed write
+	if err := os.WriteFile(filepath.Join(dir, ".memoria-tmp-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"--dir", dir, "fsck"}, nil, &stdout, &stderr); code != exitError {
+		t.Errorf("fsck exit code = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stdout.String(), "temp file: .memoria-tmp-123") {
+		t.Errorf("fsck stdout = %q, want the temp file listed", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"--dir", dir, "fsck", "--repair"}, nil, &stdout, &stderr); code != exitOK {
+		t.Errorf("fsck --repair exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "checked 1 keys: 1 problems, 1 repaired") {
+		t.Errorf("fsck --repair stdout = %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"--dir", dir, "fsck"}, nil, &stdout, &stderr); code != exitOK {
+		t.Errorf("fsck after repair exit code = %d (stderr: %s)", code, stderr.String())
+	}
+}
+
+func TestCLIFsckStoreLayout(t *testing.T) {
+	dir := t.TempDir()
+	transform, inverse := memoria.ShardedTransform(2, 2)
+	m, err := memoria.Open(memoria.Options{Basedir: dir},
+		memoria.WithPathTransform(transform, inverse), memoria.WithChecksums())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, key := range []string{"alpha", "bravo"} {
+		if err := m.WriteString(key, "value of "+key); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	m.Close()
+	layout := []string{"--dir", dir, "--transform", "sharded:2:2", "--checksum"}
+	var stdout, stderr bytes.Buffer
+
+	// without --transform every key is bad, but only reported
+	if code := run([]string{"--dir", dir, "fsck", "--repair"}, nil, &stdout, &stderr); code != exitError {
+		t.Errorf("fsck --repair with the wrong transform exit code = %d, want %d", code, exitError)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".memoria-lost+found")); !os.IsNotExist(err) {
+		t.Errorf("fsck --repair with the wrong transform moved files to lost+found")
+	}
+	stdout.Reset()
+	if code := run(append(layout, "get", "alpha"), nil, &stdout, &stderr); code != exitOK || stdout.String() != "value of alpha" {
+		t.Errorf("get after fsck --repair = %q, exit code %d (stderr: %s)", stdout.String(), code, stderr.String())
+	}
+
+	if code := run(append(layout, "fsck"), nil, &stdout, &stderr); code != exitOK {
+		t.Errorf("fsck with the store's layout exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	// values are verified against their checksums
+	path := filepath.Join(dir, "al", "ph", "alpha")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if code := run(append(layout, "fsck"), nil, &stdout, &stderr); code != exitError {
+		t.Errorf("fsck of a corrupt value exit code = %d, want %d", code, exitError)
+	}
+	if !strings.Contains(stdout.String(), "corrupt value: "+filepath.Join("al", "ph", "alpha")) {
+		t.Errorf("fsck stdout = %q, want the corrupt value listed", stdout.String())
+	}
+
+	// bad keys are moved away on request
+	if code := run([]string{"--dir", dir, "fsck", "--quarantine-bad-keys"}, nil, &stdout, &stderr); code != exitUsage {
+		t.Errorf("fsck --quarantine-bad-keys without --repair exit code = %d, want %d", code, exitUsage)
+	}
+	if code := run([]string{"--dir", dir, "fsck", "--repair", "--quarantine-bad-keys"}, nil, &stdout, &stderr); code != exitOK {
+		t.Errorf("fsck --repair --quarantine-bad-keys exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".memoria-lost+found", "br", "av", "bravo")); err != nil {
+		t.Errorf("bad key was not moved to lost+found: %v", err)
+	}
+
+	for _, transform := range []string{"sharded", "hashed:2", "sharded:0:2", "plain:1", "unknown"} {
+		if code := run([]string{"--dir", dir, "--transform", transform, "ls"}, nil, &stdout, &stderr); code != exitUsage {
+			t.Errorf("--transform %s exit code = %d, want %d", transform, code, exitUsage)
+		}
+	}
+}
+
+func TestCLIRespectsStoreLocks(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"--dir", dir, "put", "a", "value"}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("put exit code = %d (stderr: %s)", code, stderr.String())
+	}
+
+	tests := []struct {
+		lock      memoria.LockMode
+		readable  bool // whether get, ls, stat and dump may run next to the lock
+		writeable bool // whether put, append, rm and restore may
+	}{
+		{memoria.LockExclusive, false, false},
+		{memoria.LockSingleWriter, true, false},
+		{memoria.LockReadOnly, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lock.String(), func(t *testing.T) {
+			held, err := memoria.Open(memoria.Options{Basedir: dir, Lock: tt.lock})
+			if errors.Is(err, errors.ErrUnsupported) {
+				t.Skip("file locks are not supported on this platform")
+			}
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer held.Close()
+
+			for _, args := range [][]string{{"get", "a"}, {"ls"}, {"stat", "a"}, {"dump"}} {
+				checkLocked(t, dir, args, "", !tt.readable)
+			}
+			for _, args := range [][]string{{"put", "b", "x"}, {"append", "a", "x"}, {"rm", "b"}} {
+				checkLocked(t, dir, args, "", !tt.writeable)
+			}
+			checkLocked(t, dir, []string{"restore"}, "", !tt.writeable)
+			checkLocked(t, dir, []string{"fsck"}, "", true)
+		})
+	}
+}
+
+// checkLocked runs the command and checks whether it failed because the store is locked
+func checkLocked(t *testing.T, dir string, args []string, stdin string, wantLocked bool) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"--dir", dir}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	locked := strings.Contains(stderr.String(), memoria.ErrStoreLocked.Error())
+	if locked != wantLocked || (locked && code != exitError) {
+		t.Errorf("%s exit code = %d, locked = %v, want locked = %v (stderr: %s)", args[0], code, locked, wantLocked, stderr.String())
+	}
+}
@@ -0,0 +1,18 @@
+// Command memoria inspects and edits a memoria store from the command line.
+//
+//	memoria [--dir DIR] [--compression gzip|zlib|flate] [--transform T] [--checksum]
+//	        [--content-addressed] <command> [arguments]
+//
+// The options describe how the store was written and must match it.
+//
+// Exit codes are 0 on success, 1 on errors, 2 on bad usage and 3 when a key
+// does not exist, so scripts can tell a missing key apart from a failing disk.
+package main
+
+import (
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -1,6 +1,13 @@
 package memoria
 
-import "io"
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
 
 // compression interface is a writer and reader which compresses all the data it writes
 // and decompresses all the data it reads. the write and reader take a source to do so
@@ -9,4 +16,92 @@ type Compression interface {
 	Reader(src io.Reader) (io.Reader, error)
 }
 
-//TODO: Implement compression here
+// compressionMagic is written in front of every compressed value so that values
+// written before compression was enabled can still be read as they are. It is only
+// looked for by stores with compression
+var compressionMagic = []byte{0x00, 'M', 'Z', 'C'}
+
+// NewGzipCompression returns a Compression using gzip with the default compression level
+func NewGzipCompression() Compression {
+	return NewGzipCompressionLevel(flate.DefaultCompression)
+}
+
+// NewGzipCompressionLevel returns a Compression using gzip with the given level
+func NewGzipCompressionLevel(level int) Compression {
+	return &genericCompression{
+		wf: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, level) },
+		rf: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}
+}
+
+// NewZlibCompression returns a Compression using zlib with the default compression level
+func NewZlibCompression() Compression {
+	return NewZlibCompressionLevel(flate.DefaultCompression)
+}
+
+// NewZlibCompressionLevel returns a Compression using zlib with the given level
+func NewZlibCompressionLevel(level int) Compression {
+	return &genericCompression{
+		wf: func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, level) },
+		rf: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+	}
+}
+
+// NewFlateCompression returns a Compression using raw deflate with the default compression level
+func NewFlateCompression() Compression {
+	return NewFlateCompressionLevel(flate.DefaultCompression)
+}
+
+// NewFlateCompressionLevel returns a Compression using raw deflate with the given level
+func NewFlateCompressionLevel(level int) Compression {
+	return &genericCompression{
+		wf: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, level) },
+		rf: func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+	}
+}
+
+// genericCompression adapts the constructors of the standard library packages
+// to the Compression interface
+type genericCompression struct {
+	wf func(w io.Writer) (io.WriteCloser, error)
+	rf func(r io.Reader) (io.Reader, error)
+}
+
+func (g *genericCompression) Writer(dst io.Writer) (io.WriteCloser, error) {
+	return g.wf(dst)
+}
+
+func (g *genericCompression) Reader(src io.Reader) (io.Reader, error) {
+	return g.rf(src)
+}
+
+// compressWriter returns the writer values are written through. Without compression
+// this is a no-op closer around w
+func (m *Memoria) compressWriter(w io.Writer) (io.WriteCloser, error) {
+	if m.Compression == nil {
+		return &nopWriteCloser{w}, nil
+	}
+	if _, err := w.Write(compressionMagic); err != nil {
+		return nil, err
+	}
+	return m.Compression.Writer(w)
+}
+
+// decompressReader returns a reader of the uncompressed value stored in r. Values
+// without the compression header are returned as they are. Stores without compression
+// never look for the header, so their values may start with anything
+func (m *Memoria) decompressReader(r io.Reader) (io.Reader, error) {
+	if m.Compression == nil {
+		return r, nil
+	}
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(compressionMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(header, compressionMagic) {
+		return br, nil
+	}
+	br.Discard(len(compressionMagic))
+	return m.Compression.Reader(br)
+}
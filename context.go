@@ -0,0 +1,70 @@
+package memoria
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotAttempted is returned in the results of keys a bulk operation never attempted
+// because its context was done
+var ErrNotAttempted = errors.New("not attempted")
+
+// ReadCtx is Read which stops once ctx is done. The value is read from disk in chunks
+// and the context is checked before every chunk
+func (m *Memoria) ReadCtx(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return []byte{}, err
+	}
+	rc, err := m.ReadStream(key, false)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer rc.Close()
+
+	val, err := io.ReadAll(&contextReader{ctx: ctx, r: rc})
+	if err != nil {
+		return []byte{}, err
+	}
+	return val, nil
+}
+
+// WriteCtx is Write which stops once ctx is done, see WriteStreamCtx
+func (m *Memoria) WriteCtx(ctx context.Context, key string, val []byte) error {
+	return m.WriteStreamCtx(ctx, key, bytes.NewReader(val), false, false)
+}
+
+// WriteStreamCtx is WriteStream which stops once ctx is done. The context is checked
+// before every chunk copied from r, a write which is stopped leaves the old value in
+// place and returns the error of the context
+func (m *Memoria) WriteStreamCtx(ctx context.Context, key string, r io.Reader, append bool, sync bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// contexts which are never done keep the io.WriterTo of r
+	if ctx.Done() == nil {
+		return m.WriteStream(key, r, append, sync)
+	}
+	return m.WriteStream(key, &contextReader{ctx: ctx, r: r}, append, sync)
+}
+
+// contextReader fails with the error of the context once it is done. It also hides the
+// io.WriterTo of the reader so values are always copied in chunks
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// notAttempted is the error of a key a bulk operation never attempted
+func notAttempted(err error) error {
+	return fmt.Errorf("%w: %w", ErrNotAttempted, err)
+}
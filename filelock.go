@@ -0,0 +1,167 @@
+package memoria
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LockMode decides how a store opened with Open shares Basedir with other processes
+type LockMode int
+
+const (
+	// LockNone does not lock Basedir, nothing stops other processes from writing it
+	LockNone LockMode = iota
+	// LockExclusive gives the process sole access to Basedir
+	LockExclusive
+	// LockSingleWriter lets the process write while other processes may only read
+	LockSingleWriter
+	// LockReadOnly reads Basedir alongside a single writer or other readers. Every
+	// write fails with ErrReadOnly
+	LockReadOnly
+	// LockSharedWriters lets several processes write Basedir. Each write holds a lock
+	// file of its key so writes of the same key from different processes never interleave
+	LockSharedWriters
+)
+
+var (
+	// ErrStoreLocked is returned by Open when another process holds a lock on Basedir
+	// which conflicts with the requested LockMode
+	ErrStoreLocked = errors.New("store is locked by another process")
+	// ErrReadOnly is returned by writes to a store opened with LockReadOnly
+	ErrReadOnly = errors.New("store is opened read only")
+)
+
+const (
+	// storeLockName is locked exclusively by LockExclusive and shared by the other modes
+	storeLockName = internalPrefix + "lock"
+	// writerLockName is locked exclusively by LockSingleWriter and shared by LockSharedWriters
+	writerLockName = internalPrefix + "writer-lock"
+	// keyLockDirName holds the lock files of the keys written in LockSharedWriters mode
+	keyLockDirName = internalPrefix + "locks"
+)
+
+func (mode LockMode) String() string {
+	switch mode {
+	case LockNone:
+		return "none"
+	case LockExclusive:
+		return "exclusive"
+	case LockSingleWriter:
+		return "single writer"
+	case LockReadOnly:
+		return "read only"
+	case LockSharedWriters:
+		return "shared writers"
+	}
+	return fmt.Sprintf("LockMode(%d)", int(mode))
+}
+
+// storeLock holds the lock files of an open store
+type storeLock struct {
+	files []*os.File
+}
+
+// acquireStoreLock locks dir for the mode without waiting for other processes
+func acquireStoreLock(dir string, mode LockMode, perm os.FileMode) (*storeLock, error) {
+	if mode == LockNone {
+		return nil, nil
+	}
+
+	type lockFile struct {
+		name      string
+		exclusive bool
+	}
+	files := []lockFile{{storeLockName, mode == LockExclusive}}
+	switch mode {
+	case LockSingleWriter:
+		files = append(files, lockFile{writerLockName, true})
+	case LockSharedWriters:
+		files = append(files, lockFile{writerLockName, false})
+	case LockExclusive, LockReadOnly:
+	default:
+		return nil, fmt.Errorf("invalid lock mode %s", mode)
+	}
+
+	l := &storeLock{}
+	for _, lf := range files {
+		path := filepath.Join(dir, lf.name)
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, perm)
+		if err != nil && !lf.exclusive && (errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)) {
+			// shared locks are taken on lock files opened for reading as well, so
+			// stores which may only be read can still be locked once a writer made them
+			f, err = os.Open(path)
+		}
+		if err != nil {
+			l.release()
+			return nil, fmt.Errorf("cannot open lock file: %s", err)
+		}
+		l.files = append(l.files, f)
+
+		if err := flock(f, lf.exclusive, false); err != nil {
+			l.release()
+			if errors.Is(err, errWouldBlock) {
+				return nil, fmt.Errorf("%w: cannot open %s in %s mode", ErrStoreLocked, dir, mode)
+			}
+			return nil, fmt.Errorf("cannot lock %s: %w", dir, err)
+		}
+	}
+	return l, nil
+}
+
+// release unlocks and closes the lock files
+func (l *storeLock) release() error {
+	if l == nil {
+		return nil
+	}
+	var err error
+	for _, f := range l.files {
+		// closing the file releases its lock
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	l.files = nil
+	return err
+}
+
+// checkWritable returns ErrReadOnly for stores opened with LockReadOnly and stores on a
+// read only FS
+func (m *Memoria) checkWritable() error {
+	if (m.storeLock != nil && m.Lock == LockReadOnly) || isReadOnlyFS(m.FS) {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// lockKeyFile locks the lock file of the key for stores shared by several writing
+// processes and returns the function unlocking it. The caller must hold the in process
+// lock of the key so a process never waits for its own lock file
+func (m *Memoria) lockKeyFile(key string) (func(), error) {
+	if m.storeLock == nil || m.Lock != LockSharedWriters {
+		return func() {}, nil
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	dir := filepath.Join(m.Basedir, keyLockDirName, name[:2])
+	if err := os.MkdirAll(dir, m.pathPerm); err != nil {
+		return nil, fmt.Errorf("cannot create key lock directory: %s", err)
+	}
+
+	// lock files are never removed, another process may be waiting on one
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, m.filePerm)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open key lock file: %s", err)
+	}
+	if err := flock(f, true, true); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot lock key: %s", err)
+	}
+	return func() { f.Close() }, nil
+}
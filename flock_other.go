@@ -0,0 +1,16 @@
+//go:build !unix
+
+package memoria
+
+import (
+	"errors"
+	"os"
+)
+
+// errWouldBlock is never returned on platforms without flock
+var errWouldBlock = errors.New("lock is held")
+
+// flock is not supported on this platform so every LockMode other than LockNone fails
+func flock(f *os.File, exclusive bool, block bool) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package memoria
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errWouldBlock is returned by flock when the lock is held and block is false
+var errWouldBlock = syscall.EWOULDBLOCK
+
+// flock locks f with flock(2), exclusively or shared. Without block it fails with
+// errWouldBlock instead of waiting for a conflicting lock
+func flock(f *os.File, exclusive bool, block bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package memoria
+
+import (
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FS is the filesystem a store keeps its files in. Every path passed to it is built
+// from Basedir or Tempdir with filepath.Join. See NewOSFS, NewMemFS and NewReadOnlyFS
+type FS interface {
+	// Open opens the file or directory for reading
+	Open(name string) (File, error)
+	// OpenFile opens the file with the flags of os.OpenFile
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// CreateTemp creates a new file in dir like os.CreateTemp, with the permissions perm
+	// before the umask
+	CreateTemp(dir, pattern string, perm os.FileMode) (File, error)
+	// MkdirTemp creates a new directory in dir like os.MkdirTemp
+	MkdirTemp(dir, pattern string) (string, error)
+	MkdirAll(path string, perm os.FileMode) error
+	// Remove removes the file or the empty directory
+	Remove(name string) error
+	RemoveAll(path string) error
+	// Rename replaces newpath with oldpath atomically
+	Rename(oldpath, newpath string) error
+	// Link creates newname as a hard link to oldname. Snapshots fall back to holding
+	// off writes when it fails
+	Link(oldname, newname string) error
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries of the directory sorted by name
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// File is a file opened by an FS. Syncing a directory opened with Open flushes its entries
+type File interface {
+	io.Reader
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Name() string
+	Sync() error
+	Truncate(size int64) error
+}
+
+// osFS is the FS of the operating system
+type osFS struct{}
+
+// NewOSFS returns the FS of the operating system, used by stores without Options.FS
+func NewOSFS() FS {
+	return osFS{}
+}
+
+func (osFS) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) CreateTemp(dir, pattern string, perm os.FileMode) (File, error) {
+	// os.CreateTemp always uses 0600, and a Chmod afterwards would ignore the umask
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+func (osFS) MkdirTemp(dir, pattern string) (string, error) { return os.MkdirTemp(dir, pattern) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error  { return os.MkdirAll(path, perm) }
+func (osFS) Remove(name string) error                      { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error                   { return os.RemoveAll(path) }
+func (osFS) Rename(oldpath, newpath string) error          { return os.Rename(oldpath, newpath) }
+func (osFS) Link(oldname, newname string) error            { return os.Link(oldname, newname) }
+func (osFS) Stat(name string) (fs.FileInfo, error)         { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)        { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error)    { return os.ReadDir(name) }
+
+// isOSFS reports whether fsys is the FS of the operating system, which file locks need
+func isOSFS(fsys FS) bool {
+	_, ok := fsys.(osFS)
+	return ok
+}
+
+// readFile reads the whole file from fsys
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// walkDir is filepath.WalkDir on fsys
+func walkDir(fsys FS, root string, fn fs.WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirEntry(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDirEntry(fsys FS, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		// the directory is reported again so fn can decide whether to go on
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		if err := walkDirEntry(fsys, filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
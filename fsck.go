@@ -0,0 +1,365 @@
+package memoria
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// lostFoundDirName is where Repair moves the files it cannot fix
+const lostFoundDirName = internalPrefix + "lost+found"
+
+// ProblemKind classifies the problems found by Check
+type ProblemKind int
+
+const (
+	// ProblemTempFile is a temp file or snapshot directory left behind by a crash
+	ProblemTempFile ProblemKind = iota
+	// ProblemEmptyFile is a value file without any content, which a crash leaves
+	// behind when a renamed value was never flushed. Only reported for stores with
+	// Compression, Checksum or ContentAddressed set, where every value has a header
+	ProblemEmptyFile
+	// ProblemEmptyDir is a directory of the PathTransform without any keys in it
+	ProblemEmptyDir
+	// ProblemBadKey is a file which the InversePathTransform does not map back to
+	// a key stored at that path
+	ProblemBadKey
+	// ProblemCorrupt is a value which does not match its checksum or a reference to a
+	// blob which is missing or damaged
+	ProblemCorrupt
+	// ProblemOrphanExpiry is an expiry file without a value
+	ProblemOrphanExpiry
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemTempFile:
+		return "temp file"
+	case ProblemEmptyFile:
+		return "empty file"
+	case ProblemEmptyDir:
+		return "empty directory"
+	case ProblemBadKey:
+		return "bad key"
+	case ProblemCorrupt:
+		return "corrupt value"
+	case ProblemOrphanExpiry:
+		return "orphaned expiry"
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem is a single problem found by Check
+type Problem struct {
+	Kind ProblemKind
+	Path string // relative to Basedir, or absolute for files in a Tempdir outside of it
+	Key  string // the key of the file, when it has one
+	Err  error  // what is wrong, when there is more to say than the kind
+	// Repaired is set by Repair once the problem is fixed. Files which could not be
+	// fixed are moved to the lost+found directory in Basedir
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	s := fmt.Sprintf("%s: %s", p.Kind, p.Path)
+	if p.Err != nil {
+		s += ": " + p.Err.Error()
+	}
+	if p.Repaired {
+		s += " (repaired)"
+	}
+	return s
+}
+
+// CheckReport is the result of Check and Repair
+type CheckReport struct {
+	Keys     int // the number of value files checked
+	Problems []Problem
+}
+
+// Count returns the number of problems of the kind
+func (r *CheckReport) Count(kind ProblemKind) int {
+	n := 0
+	for _, p := range r.Problems {
+		if p.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Unrepaired returns the number of problems which are not repaired
+func (r *CheckReport) Unrepaired() int {
+	n := 0
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// Check walks Basedir and reports stray temp files, empty value files and directories,
+// files which do not map back to a key, corrupt values and orphaned expiry files. Every
+// value is read to verify its checksum. Check does not change anything, see Repair
+func (m *Memoria) Check(ctx context.Context) (*CheckReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.check(ctx, nil)
+}
+
+// Repair is Check which also fixes the problems it finds. Temp files, orphaned expiry
+// files and empty directories are removed, bad keys and corrupt or empty values are
+// moved to the lost+found directory in Basedir and dropped from the store. Temp files in
+// use by this store are left alone, other processes must not write Basedir meanwhile,
+// open the store with LockExclusive to make sure
+func (m *Memoria) Repair(ctx context.Context) (*CheckReport, error) {
+	return m.repair(ctx, func(ProblemKind) bool { return true })
+}
+
+// RepairKinds is Repair which only fixes the problems of the given kinds, the others are
+// reported like Check does. Leaving out ProblemBadKey keeps every file in place which
+// the store's PathTransform does not map back to a key, as happens when a store is
+// opened with another transform than it was written with
+func (m *Memoria) RepairKinds(ctx context.Context, kinds ...ProblemKind) (*CheckReport, error) {
+	return m.repair(ctx, func(kind ProblemKind) bool { return slices.Contains(kinds, kind) })
+}
+
+func (m *Memoria) repair(ctx context.Context, fixes func(ProblemKind) bool) (*CheckReport, error) {
+	if err := m.checkWritable(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check(ctx, fixes)
+}
+
+// check is Check and Repair, fixing the problems of the kinds fixes returns true for.
+// The caller must hold the store's mutex
+func (m *Memoria) check(ctx context.Context, fixes func(ProblemKind) bool) (*CheckReport, error) {
+	report := &CheckReport{}
+	base := filepath.Clean(m.Basedir)
+	dirs := []string{}
+
+	add := func(p Problem, fix func() error) {
+		if fixes != nil && fixes(p.Kind) {
+			if err := fix(); err != nil {
+				p.Err = errors.Join(p.Err, fmt.Errorf("cannot repair: %s", err))
+			} else {
+				p.Repaired = true
+			}
+		}
+		report.Problems = append(report.Problems, p)
+	}
+
+	err := walkDir(m.FS, base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == base {
+			return nil
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+
+		if d.IsDir() {
+			if m.isStrayTemp(path, name) {
+				add(Problem{Kind: ProblemTempFile, Path: rel}, func() error { return m.FS.RemoveAll(path) })
+				return filepath.SkipDir
+			}
+			if isInternalFile(name) || (m.Tempdir != "" && path == filepath.Clean(m.Tempdir)) {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		switch {
+		case m.isStrayTemp(path, name):
+			add(Problem{Kind: ProblemTempFile, Path: rel}, func() error { return m.FS.Remove(path) })
+		case strings.HasPrefix(name, ttlFilePrefix):
+			// an expiry which names no value cannot be matched to one either
+			_, valueName, err := parseExpiry(m.FS, path)
+			if err == nil {
+				_, err = m.FS.Lstat(filepath.Join(filepath.Dir(path), valueName))
+			}
+			if err != nil {
+				add(Problem{Kind: ProblemOrphanExpiry, Path: rel}, func() error { return m.FS.Remove(path) })
+			}
+		case isInternalFile(name) || !d.Type().IsRegular():
+		default:
+			report.Keys++
+			m.checkValue(path, rel, add)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if m.Tempdir != "" {
+		if err := m.checkTempdir(base, add); err != nil {
+			return report, err
+		}
+	}
+
+	// children come after their parents in the walk so they are pruned first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := m.FS.ReadDir(dirs[i])
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		dir := dirs[i]
+		rel, _ := filepath.Rel(base, dir)
+		add(Problem{Kind: ProblemEmptyDir, Path: rel}, func() error { return m.FS.Remove(dir) })
+	}
+	return report, nil
+}
+
+// checkValue checks the value file at path
+func (m *Memoria) checkValue(path, rel string, add func(Problem, func() error)) {
+	key := m.InverseTransform(pathKeyFor(rel))
+	pathKey, err := m.transform(key)
+	if err == nil && m.completePath(pathKey) != path {
+		err = fmt.Errorf("maps to key %q which is stored at %s", key, m.completePath(pathKey))
+	}
+	if err != nil {
+		add(Problem{Kind: ProblemBadKey, Path: rel, Err: err}, func() error { return m.quarantine(path) })
+		return
+	}
+
+	// forget drops the key from the store once its file is quarantined
+	forget := func(files ...string) func() error {
+		return func() error {
+			for _, file := range files {
+				if err := m.quarantine(file); err != nil {
+					return err
+				}
+			}
+			return m.forgetKey(key, pathKey)
+		}
+	}
+
+	if info, err := m.FS.Stat(path); err == nil && info.Size() == 0 && m.hasHeaders() {
+		add(Problem{Kind: ProblemEmptyFile, Path: rel, Key: key}, forget(path))
+		return
+	}
+
+	err = m.verifyKeyFile(key, path)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrCorrupt):
+		files := []string{path}
+		// a damaged blob is quarantined as well so it is not deduplicated into new values
+		if source, serr := m.valueFile(path); serr == nil && source != path {
+			if _, serr := m.FS.Stat(source); serr == nil {
+				files = append(files, source)
+			}
+		}
+		add(Problem{Kind: ProblemCorrupt, Path: rel, Key: key, Err: err}, forget(files...))
+	case errors.Is(err, fs.ErrNotExist):
+		// the key was erased since it was listed
+	default:
+		add(Problem{Kind: ProblemCorrupt, Path: rel, Key: key, Err: err}, func() error { return err })
+	}
+}
+
+// checkTempdir reports the stray temp files in Tempdir, which the walk of Basedir skips
+func (m *Memoria) checkTempdir(base string, add func(Problem, func() error)) error {
+	tempdir := filepath.Clean(m.Tempdir)
+	entries, err := m.FS.ReadDir(tempdir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(tempdir, entry.Name())
+		if entry.IsDir() || !m.isStrayTemp(path, entry.Name()) {
+			continue
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = path
+		}
+		add(Problem{Kind: ProblemTempFile, Path: rel}, func() error { return m.FS.Remove(path) })
+	}
+	return nil
+}
+
+// isStrayTemp reports whether the file or directory at path is a temp file which no
+// operation of this store is using
+func (m *Memoria) isStrayTemp(path, name string) bool {
+	if !strings.HasPrefix(name, tempFilePrefix) && !strings.HasPrefix(name, internalPrefix+"snapshot-") &&
+		!strings.HasPrefix(name, internalPrefix+"restore-") {
+		return false
+	}
+	return !m.inUse(path)
+}
+
+// inUse reports whether the file or directory at path is tracked by an operation
+func (m *Memoria) inUse(path string) bool {
+	m.inFlightMu.Lock()
+	defer m.inFlightMu.Unlock()
+	return m.inFlight[path] > 0
+}
+
+// hasHeaders reports whether every value written by the store starts with a header
+func (m *Memoria) hasHeaders() bool {
+	return m.Compression != nil || m.Checksum || m.ContentAddressed
+}
+
+// quarantine moves the file at path into the lost+found directory, keeping its path
+// relative to Basedir
+func (m *Memoria) quarantine(path string) error {
+	rel, err := filepath.Rel(m.Basedir, path)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(m.Basedir, lostFoundDirName, rel)
+	if err := m.FS.MkdirAll(filepath.Dir(dst), m.pathPerm); err != nil {
+		return err
+	}
+	// files quarantined before are kept
+	for i := 1; ; i++ {
+		if _, err := m.FS.Lstat(dst); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		dst = filepath.Join(m.Basedir, lostFoundDirName, rel) + "." + strconv.Itoa(i)
+	}
+	return m.FS.Rename(path, dst)
+}
+
+// track records that the temp file or directory at path is in use so Repair leaves it
+// alone, or the blob at path so CollectGarbage does, and returns the function to call once it is renamed or removed
+func (m *Memoria) track(path string) func() {
+	m.inFlightMu.Lock()
+	if m.inFlight == nil {
+		m.inFlight = make(map[string]int)
+	}
+	m.inFlight[path]++
+	m.inFlightMu.Unlock()
+
+	return func() {
+		m.inFlightMu.Lock()
+		if m.inFlight[path]--; m.inFlight[path] <= 0 {
+			delete(m.inFlight, path)
+		}
+		m.inFlightMu.Unlock()
+	}
+}
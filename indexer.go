@@ -1,8 +1,309 @@
 package memoria
 
+import (
+	"sort"
+	"sync"
+)
+
 type Indexer interface {
 	Initialize(keys <-chan string)
 	Insert(key string)
 	Delete(key string)
 	Keys(frm string, n int) []string
 }
+
+// btreeDegree is the minimum degree of the B-tree, every node other than the root
+// holds between btreeDegree-1 and 2*btreeDegree-1 keys
+const btreeDegree = 32
+
+const btreeMaxItems = 2*btreeDegree - 1
+
+// BTreeIndex is an in-memory Indexer which keeps the keys of the store sorted in a B-tree.
+// It is safe for concurrent use
+type BTreeIndex struct {
+	mu   sync.RWMutex
+	root *btreeNode
+	len  int
+}
+
+// NewBTreeIndex returns an empty BTreeIndex. Memoria fills it from Basedir when it is
+// passed as Options.Index
+func NewBTreeIndex() *BTreeIndex {
+	return &BTreeIndex{}
+}
+
+// Initialize replaces the contents of the index with the keys read from the channel
+func (b *BTreeIndex) Initialize(keys <-chan string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.root = nil
+	b.len = 0
+	for key := range keys {
+		b.insert(key)
+	}
+}
+
+// Insert adds the key to the index. Inserting a key twice is a no-op
+func (b *BTreeIndex) Insert(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.insert(key)
+}
+
+// Delete removes the key from the index
+func (b *BTreeIndex) Delete(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.root == nil {
+		return
+	}
+	if b.root.remove(key) {
+		b.len--
+	}
+	// the root is the only node allowed to become empty, shrink the tree when it does
+	if len(b.root.items) == 0 {
+		if b.root.leaf() {
+			b.root = nil
+		} else {
+			b.root = b.root.children[0]
+		}
+	}
+}
+
+// Keys returns at most n keys in sorted order. When frm is empty the first n keys are
+// returned, otherwise the keys start right after frm so pages can be chained by passing
+// the last key of the previous page
+func (b *BTreeIndex) Keys(frm string, n int) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	keys := []string{}
+	if b.root == nil || n <= 0 {
+		return keys
+	}
+	b.root.ascendAfter(frm, func(key string) bool {
+		keys = append(keys, key)
+		return len(keys) < n
+	})
+	return keys
+}
+
+// Len returns the number of keys in the index
+func (b *BTreeIndex) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.len
+}
+
+func (b *BTreeIndex) insert(key string) {
+	if b.root == nil {
+		b.root = &btreeNode{items: []string{key}}
+		b.len++
+		return
+	}
+	// split a full root before descending so there is always room for the median
+	if len(b.root.items) == btreeMaxItems {
+		old := b.root
+		b.root = &btreeNode{children: []*btreeNode{old}}
+		b.root.splitChild(0)
+	}
+	if b.root.insert(key) {
+		b.len++
+	}
+}
+
+// btreeNode is a node of the B-tree. Leaves have no children, inner nodes have
+// exactly len(items)+1 children
+type btreeNode struct {
+	items    []string
+	children []*btreeNode
+}
+
+func (n *btreeNode) leaf() bool {
+	return len(n.children) == 0
+}
+
+// find returns the index of the first item >= key and whether that item is key
+func (n *btreeNode) find(key string) (int, bool) {
+	i := sort.SearchStrings(n.items, key)
+	return i, i < len(n.items) && n.items[i] == key
+}
+
+// splitChild splits the full child i in two and moves its median up into n
+func (n *btreeNode) splitChild(i int) {
+	child := n.children[i]
+	median := child.items[btreeDegree-1]
+
+	right := &btreeNode{items: append([]string(nil), child.items[btreeDegree:]...)}
+	if !child.leaf() {
+		right.children = append([]*btreeNode(nil), child.children[btreeDegree:]...)
+		child.children = child.children[:btreeDegree]
+	}
+	child.items = child.items[:btreeDegree-1]
+
+	n.items = insertItem(n.items, i, median)
+	n.children = insertChild(n.children, i+1, right)
+}
+
+// insert adds key to the subtree rooted at n which must not be full. Returns false
+// if the key was already present
+func (n *btreeNode) insert(key string) bool {
+	i, found := n.find(key)
+	if found {
+		return false
+	}
+	if n.leaf() {
+		n.items = insertItem(n.items, i, key)
+		return true
+	}
+	if len(n.children[i].items) == btreeMaxItems {
+		n.splitChild(i)
+		if key == n.items[i] {
+			return false
+		}
+		if key > n.items[i] {
+			i++
+		}
+	}
+	return n.children[i].insert(key)
+}
+
+// remove deletes key from the subtree rooted at n. Every node it descends into is
+// first given at least btreeDegree items so the removal never underflows a node
+func (n *btreeNode) remove(key string) bool {
+	i, found := n.find(key)
+	if n.leaf() {
+		if !found {
+			return false
+		}
+		n.items = removeItem(n.items, i)
+		return true
+	}
+
+	if found {
+		left, right := n.children[i], n.children[i+1]
+		switch {
+		case len(left.items) >= btreeDegree:
+			pred := left.max()
+			n.items[i] = pred
+			return left.remove(pred)
+		case len(right.items) >= btreeDegree:
+			succ := right.min()
+			n.items[i] = succ
+			return right.remove(succ)
+		default:
+			n.merge(i)
+			return left.remove(key)
+		}
+	}
+
+	if len(n.children[i].items) < btreeDegree {
+		i = n.grow(i)
+	}
+	return n.children[i].remove(key)
+}
+
+// grow makes sure child i has at least btreeDegree items by borrowing from a sibling
+// or merging with one. Returns the index of the child that now holds its items
+func (n *btreeNode) grow(i int) int {
+	child := n.children[i]
+
+	if i > 0 && len(n.children[i-1].items) >= btreeDegree {
+		left := n.children[i-1]
+		child.items = insertItem(child.items, 0, n.items[i-1])
+		n.items[i-1] = left.items[len(left.items)-1]
+		left.items = left.items[:len(left.items)-1]
+		if !left.leaf() {
+			child.children = insertChild(child.children, 0, left.children[len(left.children)-1])
+			left.children = left.children[:len(left.children)-1]
+		}
+		return i
+	}
+
+	if i < len(n.items) && len(n.children[i+1].items) >= btreeDegree {
+		right := n.children[i+1]
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = removeItem(right.items, 0)
+		if !right.leaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = removeChild(right.children, 0)
+		}
+		return i
+	}
+
+	if i == len(n.items) {
+		i--
+	}
+	n.merge(i)
+	return i
+}
+
+// merge joins child i, item i and child i+1 into child i
+func (n *btreeNode) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	n.items = removeItem(n.items, i)
+	n.children = removeChild(n.children, i+1)
+}
+
+func (n *btreeNode) min() string {
+	for !n.leaf() {
+		n = n.children[0]
+	}
+	return n.items[0]
+}
+
+func (n *btreeNode) max() string {
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+	return n.items[len(n.items)-1]
+}
+
+// ascendAfter calls fn for every key greater than frm in order until fn returns false
+func (n *btreeNode) ascendAfter(frm string, fn func(key string) bool) bool {
+	i := sort.Search(len(n.items), func(j int) bool { return n.items[j] > frm })
+	for ; i < len(n.items); i++ {
+		if !n.leaf() && !n.children[i].ascendAfter(frm, fn) {
+			return false
+		}
+		if !fn(n.items[i]) {
+			return false
+		}
+	}
+	if !n.leaf() {
+		return n.children[len(n.children)-1].ascendAfter(frm, fn)
+	}
+	return true
+}
+
+func insertItem(s []string, i int, item string) []string {
+	s = append(s, "")
+	copy(s[i+1:], s[i:])
+	s[i] = item
+	return s
+}
+
+func removeItem(s []string, i int) []string {
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = ""
+	return s[:len(s)-1]
+}
+
+func insertChild(s []*btreeNode, i int, child *btreeNode) []*btreeNode {
+	s = append(s, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = child
+	return s
+}
+
+func removeChild(s []*btreeNode, i int) []*btreeNode {
+	copy(s[i:], s[i+1:])
+	s[len(s)-1] = nil
+	return s[:len(s)-1]
+}
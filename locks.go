@@ -0,0 +1,97 @@
+package memoria
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// keyLockStripes is the number of maps the key locks are spread over so writers of
+// different keys rarely wait for the same mutex
+const keyLockStripes = 64
+
+// keyLockStripe holds the locks of the keys hashed to it
+type keyLockStripe struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock serializes the writers of one key
+type keyLock struct {
+	mu   sync.Mutex
+	refs int // writers holding or waiting for the lock
+}
+
+// lockWrite locks the key before it is written or erased, in this process and for
+// stores shared by several writing processes in the others as well. Writes to stores
+// opened read only fail with ErrReadOnly
+func (m *Memoria) lockWrite(key string) (func(), error) {
+	if err := m.checkWritable(); err != nil {
+		return nil, err
+	}
+	unlock := m.lockKey(key)
+	unlockFile, err := m.lockKeyFile(key)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		unlock()
+	}, nil
+}
+
+// lockWrites locks the keys with lockWrite in sorted order, so writers locking several
+// keys at once never deadlock, and returns the function unlocking all of them
+func (m *Memoria) lockWrites(keys []string) (func(), error) {
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+
+	unlocks := make([]func(), 0, len(keys))
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, key := range keys {
+		unlock, err := m.lockWrite(key)
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
+
+// lockKey locks the key for writing and returns the function unlocking it. Keys are
+// locked before the store's mutex is taken. Every key has a lock of its own, so holding
+// one never blocks writers of other keys
+func (m *Memoria) lockKey(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	stripe := &m.keyLocks[h.Sum32()%keyLockStripes]
+
+	stripe.mu.Lock()
+	if stripe.locks == nil {
+		stripe.locks = make(map[string]*keyLock)
+	}
+	l, ok := stripe.locks[key]
+	if !ok {
+		l = &keyLock{}
+		stripe.locks[key] = l
+	}
+	l.refs++
+	stripe.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		stripe.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(stripe.locks, key)
+		}
+		stripe.mu.Unlock()
+	}
+}
@@ -0,0 +1,492 @@
+package memoria
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errNotDir      = errors.New("not a directory")
+	errIsDir       = errors.New("is a directory")
+	errDirNotEmpty = errors.New("directory not empty")
+)
+
+// memFS is an FS which keeps every file in memory
+type memFS struct {
+	mu   sync.Mutex // guards every node and open file
+	root *memNode
+	seq  atomic.Uint64 // names temp files and directories
+}
+
+// memNode is a file or directory of a memFS. Hard links share the node
+type memNode struct {
+	mode     fs.FileMode
+	data     []byte
+	children map[string]*memNode // the entries of a directory
+	modTime  time.Time
+}
+
+// NewMemFS returns an empty FS which keeps every file in memory, for tests and stores
+// which do not have to outlive the process. Relative paths are relative to its root
+func NewMemFS() FS {
+	return &memFS{root: newMemDir(fs.ModePerm)}
+}
+
+func newMemDir(perm fs.FileMode) *memNode {
+	return &memNode{mode: fs.ModeDir | perm.Perm(), children: make(map[string]*memNode), modTime: time.Now()}
+}
+
+func (n *memNode) isDir() bool {
+	return n.mode.IsDir()
+}
+
+// splitPath splits name into the names of the directories leading to it from the root
+func splitPath(name string) []string {
+	name = filepath.ToSlash(filepath.Clean(name[len(filepath.VolumeName(name)):]))
+	name = strings.Trim(name, "/")
+	if name == "" || name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// lookupParent returns the directory holding name and the base name of name, the
+// caller must hold mu
+func (m *memFS) lookupParent(op, name string) (*memNode, string, error) {
+	parts := splitPath(name)
+	if len(parts) == 0 {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	dir := m.root
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := dir.children[part]
+		if !ok {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if !child.isDir() {
+			return nil, "", &fs.PathError{Op: op, Path: name, Err: errNotDir}
+		}
+		dir = child
+	}
+	return dir, parts[len(parts)-1], nil
+}
+
+// lookup returns the node at name, the caller must hold mu
+func (m *memFS) lookup(op, name string) (*memNode, error) {
+	if len(splitPath(name)) == 0 {
+		return m.root, nil
+	}
+	dir, base, err := m.lookupParent(op, name)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := dir.children[base]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return n, nil
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.openFile(name, flag, perm)
+}
+
+// openFile is OpenFile, the caller must hold mu
+func (m *memFS) openFile(name string, flag int, perm os.FileMode) (File, error) {
+	name = filepath.Clean(name)
+	n, err := m.lookup("open", name)
+	switch {
+	case err == nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		dir, base, err := m.lookupParent("open", name)
+		if err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		dir.children[base] = n
+	case err != nil:
+		return nil, err
+	}
+
+	f := &memFile{fs: m, name: name, node: n, flag: flag}
+	if n.isDir() && f.writable() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	}
+	if flag&os.O_TRUNC != 0 && f.writable() {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return f, nil
+}
+
+func (m *memFS) CreateTemp(dir, pattern string, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		f, err := m.openFile(m.tempName(dir, pattern), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+func (m *memFS) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		name := m.tempName(dir, pattern)
+		err := m.mkdir(name, 0700)
+		if !errors.Is(err, fs.ErrExist) {
+			return name, err
+		}
+	}
+}
+
+// tempName returns a new name in dir made of the pattern with its last "*" replaced
+func (m *memFS) tempName(dir, pattern string) string {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	return filepath.Join(dir, prefix+strconv.FormatUint(m.seq.Add(1), 10)+suffix)
+}
+
+// mkdir creates the directory, the caller must hold mu
+func (m *memFS) mkdir(name string, perm os.FileMode) error {
+	dir, base, err := m.lookupParent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[base]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	dir.children[base] = newMemDir(perm)
+	return nil
+}
+
+func (m *memFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(path, perm)
+}
+
+func (m *memFS) mkdirAll(path string, perm os.FileMode) error {
+	n, err := m.lookup("mkdir", path)
+	if err == nil {
+		if !n.isDir() {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errNotDir}
+		}
+		return nil
+	}
+	if err := m.mkdirAll(filepath.Dir(path), perm); err != nil {
+		return err
+	}
+	return m.mkdir(path, perm)
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.lookupParent("remove", name)
+	if err != nil {
+		return err
+	}
+	n, ok := dir.children[base]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.isDir() && len(n.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errDirNotEmpty}
+	}
+	delete(dir.children, base)
+	return nil
+}
+
+func (m *memFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.lookupParent("removeall", path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	delete(dir.children, base)
+	return nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldDir, oldBase, err := m.lookupParent("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	n, ok := oldDir.children[oldBase]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	if n.isDir() && strings.HasPrefix(filepath.Clean(newpath)+string(filepath.Separator), filepath.Clean(oldpath)+string(filepath.Separator)) {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrInvalid}
+	}
+	newDir, newBase, err := m.lookupParent("rename", newpath)
+	if err != nil {
+		return err
+	}
+	if old, ok := newDir.children[newBase]; ok {
+		switch {
+		case old == n:
+			return nil
+		case old.isDir() && !n.isDir():
+			return &fs.PathError{Op: "rename", Path: newpath, Err: errIsDir}
+		case !old.isDir() && n.isDir():
+			return &fs.PathError{Op: "rename", Path: newpath, Err: errNotDir}
+		case old.isDir() && len(old.children) > 0:
+			return &fs.PathError{Op: "rename", Path: newpath, Err: errDirNotEmpty}
+		}
+	}
+	delete(oldDir.children, oldBase)
+	newDir.children[newBase] = n
+	return nil
+}
+
+func (m *memFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("link", oldname)
+	if err != nil {
+		return err
+	}
+	if n.isDir() {
+		return &fs.PathError{Op: "link", Path: oldname, Err: errIsDir}
+	}
+	dir, base, err := m.lookupParent("link", newname)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[base]; ok {
+		return &fs.PathError{Op: "link", Path: newname, Err: fs.ErrExist}
+	}
+	dir.children[base] = n
+	return nil
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(name)), nil
+}
+
+// Lstat is Stat, a memFS has no symbolic links
+func (m *memFS) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for childName, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info(childName)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// info returns the current FileInfo of the node, the caller must hold mu
+func (n *memNode) info(name string) fs.FileInfo {
+	return &memFileInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *memFileInfo) Sys() any           { return nil }
+
+// memFile is a file of a memFS opened with OpenFile
+type memFile struct {
+	fs     *memFS
+	name   string
+	node   *memNode
+	flag   int
+	off    int64
+	closed bool
+}
+
+func (f *memFile) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// check returns the error of an operation on the file, the caller must hold mu
+func (f *memFile) check(op string, write bool) error {
+	switch {
+	case f.closed:
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	case f.node.isDir():
+		return &fs.PathError{Op: op, Path: f.name, Err: errIsDir}
+	case write && !f.writable(), !write && f.flag&os.O_WRONLY != 0:
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.node.data))
+	}
+	f.writeAt(p, f.off)
+	f.off += int64(len(p))
+	return len(p), nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("writeat", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 || off < 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.writeAt(p, off)
+	return len(p), nil
+}
+
+// writeAt writes p at off, growing the file as needed. The caller must hold mu
+func (f *memFile) writeAt(p []byte, off int64) {
+	if end := off + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[off:], p)
+	f.node.modTime = time.Now()
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+// Sync does nothing, a memFS has nothing to flush
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
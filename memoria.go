@@ -2,12 +2,21 @@ package memoria
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -15,7 +24,16 @@ const (
 	defaultPathPerm   os.FileMode = 0777
 	defaultFilePerm   os.FileMode = 0666
 	defaultBaseDir                = "memoria"
-	defaultCacheSize              = 512 // 512 bytes as default cache size
+	defaultCacheSize              = 512         // 512 bytes as default cache size
+	internalPrefix                = ".memoria-" // prefix of every file memoria keeps for itself
+	tempFilePrefix                = internalPrefix + "tmp-"
+	tempFilePattern               = tempFilePrefix + "*"
+	dumpFileName                  = "backup.dump" // written by older versions, never a key
+)
+
+var (
+	// ErrKeyNotFound is returned when the requested key does not exist in the store
+	ErrKeyNotFound = errors.New("key not found")
 )
 
 var (
@@ -24,8 +42,8 @@ var (
 	}
 )
 var defaultInverseTransform = func(pathKey *PathKey) string {
-	// Rebuild the key by joining the path parts and appending the filename
-	return fmt.Sprintf("%s/%s", filepath.Join(pathKey.Path...), pathKey.FileName)
+	// defaultTransform stores the whole key as the filename
+	return pathKey.FileName
 }
 
 type PathKey struct {
@@ -35,7 +53,8 @@ type PathKey struct {
 }
 
 // A Path transform function converts "abcdef" to ["ab","cde","f"]
-// so the final  location of the data file will be <basedir>/ab/cde/f/abcdef
+// so the final  location of the data file will be <basedir>/ab/cde/f/abcdef.
+// See ShardedTransform and HashedTransform for the built in ones
 type PathTransform func(key string) *PathKey
 
 // inv transform func takes file path as input and returns the original key
@@ -44,25 +63,84 @@ type InversePathTransform func(pathKey *PathKey) string
 type Options struct {
 	MaxCacheSize uint64
 	Basedir      string
-	// Tempdir       string solve for issues
+	// Tempdir is where values are written before being renamed into place. It must be on
+	// the same filesystem as Basedir. When empty temp files are created next to the key file
+	Tempdir              string
 	pathPerm             os.FileMode
 	filePerm             os.FileMode
 	PathTransform        PathTransform
 	InversePathTransform InversePathTransform
-	cachePolicy          CachePolicy
-	bufferSize           int // the reading and writing is bufferd in memria so this feild represents the size of that buffer
-	// compression Compression this field represents a compression mechanism for the store
-	// index Indexer this field is for the stores that have some sort of ordering
-
+	// CachePolicy decides which keys are ejected when the cache is full. Defaults to
+	// ejecting random keys, see LRUCachePolicy, LFUCachePolicy and ARCCachePolicy
+	CachePolicy CachePolicy
+	bufferSize  int // the reading and writing is bufferd in memria so this feild represents the size of that buffer
+	// Compression represents a compression mechanism for the store. Values written
+	// before it was set are still read as they are
+	Compression Compression
+	// SweepInterval is how often expired keys are deleted from disk in the background.
+	// Zero disables the sweeper, expired keys are then only hidden from reads
+	SweepInterval time.Duration
+	// WAL enables the write-ahead log used by WriteBatch and BulkWrite. It is only
+	// opened, and replayed after a crash, by Open
+	WAL bool
+	// WALSync decides when the write-ahead log is flushed to disk
+	WALSync WALSyncPolicy
+	// WALSyncPeriod is how often the log is flushed with WALSyncPeriodic, defaults to a second
+	WALSyncPeriod time.Duration
+	// ContentAddressed stores every distinct value once as a blob named after its
+	// SHA-256 digest. Key files only reference the blob, see CollectGarbage
+	ContentAddressed bool
+	// Checksum stores the CRC-32C of every value written and verifies it on every read
+	// from disk, a value which does not match fails with ErrCorrupt. See Verify and Scrub.
+	// Values written before it was set are still read as they are
+	Checksum bool
+	// Index keeps the keys of the store in some sort of ordering. It is filled from
+	// Basedir when the store is created, without the expired keys, and kept up to date
+	// on every Write and Erase. A key which expires later stays in the index until the
+	// sweeper or DeleteExpired erases it
+	Index Indexer
+	// Lock decides how Basedir is shared with other processes. It is only acquired by
+	// Open. The cache of a store is not told about writes by other processes, bypass it
+	// to read their latest values
+	Lock LockMode
+	// FS is the filesystem the store keeps its files in, defaults to the one of the
+	// operating system. See NewMemFS and NewReadOnlyFS
+	FS FS
 }
 type Memoria struct {
 	Options
+	// mu is held for reading while a value file is opened or a temp file is created,
+	// and for writing while a value is published. Copying values never holds it
+	mu sync.RWMutex
+
+	cacheMu   sync.Mutex // guards the cache and the CachePolicy
 	cache     map[string][]byte
-	mu        sync.RWMutex
 	cacheSize uint64
+
+	expiryMu sync.Mutex
+	expiry   map[string]time.Time // expiry of the keys read or written with a ttl
+
+	wal       *writeAheadLog // only set for stores created with Open and Options.WAL
+	storeLock *storeLock     // only set for stores created with Open and Options.Lock
+
+	inFlightMu sync.Mutex
+	inFlight   map[string]int // temp files and directories in use, left alone by Repair
+
+	versionMu   sync.Mutex
+	versions    map[string]*keyVersion // version of the keys watched by transactions and reads
+	versionSeq  uint64
+	eraseAllSeq uint64 // version of every key at the last EraseAll
+
+	keyLocks [keyLockStripes]keyLockStripe // locks of the keys being written
+
+	stopSweeper chan struct{}
+	sweeperDone chan struct{}
+	closeOnce   sync.Once
 }
 
-// returns an intiialised Memoria strucutre
+// returns an intiialised Memoria strucutre. New does not create or validate Basedir,
+// see Open for that, but it walks Basedir to fill Options.Index and starts the sweeper
+// when SweepInterval is set and the store is not read only
 func New(o Options) *Memoria {
 
 	if o.Basedir == "" {
@@ -77,8 +155,8 @@ func New(o Options) *Memoria {
 		o.InversePathTransform = defaultInverseTransform
 	}
 
-	if o.cachePolicy == nil {
-		o.cachePolicy = &defaultCachePolicy{}
+	if o.CachePolicy == nil {
+		o.CachePolicy = &defaultCachePolicy{}
 	}
 
 	if o.bufferSize == 0 {
@@ -94,20 +172,39 @@ func New(o Options) *Memoria {
 	}
 
 	if o.pathPerm == 0 {
-		o.filePerm = defaultPathPerm
+		o.pathPerm = defaultPathPerm
+	}
+
+	if o.FS == nil {
+		o.FS = NewOSFS()
 	}
 
 	m := &Memoria{
-		Options: o,
-		cache:   make(map[string][]byte),
+		Options:  o,
+		cache:    make(map[string][]byte),
+		expiry:   make(map[string]time.Time),
+		versions: make(map[string]*keyVersion),
+	}
+
+	if m.Index != nil {
+		m.Index.Initialize(m.Keys(nil))
+	}
+
+	if m.SweepInterval > 0 && m.Lock != LockReadOnly && !isReadOnlyFS(m.FS) {
+		m.startSweeper()
 	}
 	return m
 }
 
-func (m *Memoria) transform(key string) (pathkey *PathKey) {
-	pathkey = m.PathTransform(key)
-	pathkey.originalKey = key
-	return pathkey
+// transform maps the key to its file and rejects paths which would not stay inside
+// Basedir, see validatePathKey
+func (m *Memoria) transform(key string) (*PathKey, error) {
+	pathKey := m.PathTransform(key)
+	if err := validatePathKey(key, pathKey); err != nil {
+		return nil, err
+	}
+	pathKey.originalKey = key
+	return pathKey, nil
 }
 
 func (m *Memoria) InverseTransform(pathKey *PathKey) string {
@@ -130,149 +227,397 @@ func (m *Memoria) WriteString(key, val string) error {
 }
 
 // writes the data given by the io.reader  performs explicit sync if mentioned otherwise
-// depedning on the physical media it sync
+// depedning on the physical media it sync. The data is first written to a temp file
+// which is renamed over the key file once complete, so readers only ever see the old
+// value or the new one
 func (m *Memoria) WriteStream(key string, r io.Reader, append bool, sync bool) error { //adding the append bool
+	return m.writeStream(key, r, append, sync, time.Time{})
+}
+
+// writeStream is WriteStream which also sets the expiry of the key. A zero expiresAt
+// removes the expiry of the key, except for appends which keep it
+func (m *Memoria) writeStream(key string, r io.Reader, append bool, sync bool, expiresAt time.Time) error {
 
 	if len(key) <= 0 {
 		return fmt.Errorf("Empty key")
 	}
 
-	pathKey := m.transform(key)
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return err
+	}
 
-	//TODO: check for bad paths check if any part contains / after being transformed
+	unlock, err := m.lockWrite(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.writeKeyLocked(pathKey, r, append, sync, expiresAt)
+}
 
-	if err := m.createDirIfMissing(pathKey); err != nil {
-		return fmt.Errorf("Cannot create directory: %s", err)
+// writeKeyLocked is writeStream for a key the caller has locked with lockWrite
+func (m *Memoria) writeKeyLocked(pathKey *PathKey, r io.Reader, append bool, sync bool, expiresAt time.Time) error {
+	// only creating the temp file and publishing it hold the store's mutex, the
+	// value itself is copied while other keys are read and written
+	m.mu.RLock()
+	v, err := m.stageValue(pathKey)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
 	}
+	defer v.untrack()
 
-	if !append {
+	// for appends the current value is copied into the temp file first so a
+	// failed append leaves the old value untouched
+	if append {
+		if err := m.copyKeyFile(v.dst, pathKey); err != nil {
+			return v.abort(fmt.Errorf("Cannot copy existing value: %w", err))
+		}
+	}
 
-		f, err := m.createKeyFile(pathKey)
+	// this is the place where data transfers actually happens when
+	// we transfer a read buffer to a writer
+	if _, err := io.CopyBuffer(v.dst, r, make([]byte, m.bufferSize)); err != nil {
+		return v.abort(fmt.Errorf("Cannot copy from read buffer %w", err))
+	}
 
-		if err != nil {
-			return fmt.Errorf("cannot create key file: %s", err)
-		}
+	if err := v.flush(sync); err != nil {
+		return err
+	}
+	return m.publish(v, sync, append, expiresAt)
+}
 
-		wc := io.WriteCloser(&nopWriteCloser{f})
+// stagedValue is a value written to a temp file which is renamed over the key file
+// once it is complete
+type stagedValue struct {
+	pathKey  *PathKey
+	fsys     FS
+	f        File
+	wc       io.WriteCloser
+	dst      io.Writer // writes to wc, digest and checksum
+	digest   hash.Hash
+	checksum hash.Hash32 // the CRC-32C of the uncompressed value when Options.Checksum is set
+
+	// set by stageFiles
+	src       string    // the file renamed over the key file
+	blob      string    // the blob of content addressed values
+	ref       File      // the reference to the blob, closed by finishRef
+	expiry    string    // the temp file of the new expiry, if any
+	oldExpiry time.Time // the expiry put back when the value cannot be renamed into place
+
+	untracks []func() // the files in use, see untrack
+}
 
-		//TODO: replace wc with compression writer when implementing compression
+// stageValue creates the temp file for a new value of the key, the caller must hold
+// the store's mutex for reading so the directories are not pruned in the meantime
+func (m *Memoria) stageValue(pathKey *PathKey) (*stagedValue, error) {
+	if err := m.createDirIfMissing(pathKey); err != nil {
+		return nil, fmt.Errorf("Cannot create directory: %w", err)
+	}
 
-		// this is the place where data transfers actually happens when
-		// we transfer a read buffer to a writer
-		if _, err := io.Copy(wc, r); err != nil {
-			return cleanUp(f, fmt.Errorf("Cannot copy from read buffer %s", err))
-		}
+	f, err := m.createKeyFile(pathKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create key file: %w", err)
+	}
 
-		if err := wc.Close(); err != nil {
-			return cleanUp(f, fmt.Errorf("Cannot close compression error %s", err))
+	if m.Checksum {
+		if err := writeChecksumHeader(f); err != nil {
+			return nil, cleanUp(m.FS, f, fmt.Errorf("Cannot write checksum header %w", err))
 		}
+	}
 
-		if sync {
-			if err := f.Sync(); err != nil {
-				cleanUp(f, fmt.Errorf("Cannot Sync: %s", err))
-			}
+	wc, err := m.compressWriter(f)
+	if err != nil {
+		return nil, cleanUp(m.FS, f, fmt.Errorf("Cannot create compression writer %w", err))
+	}
+
+	v := &stagedValue{pathKey: pathKey, fsys: m.FS, f: f, wc: wc}
+	v.track(m, f.Name())
+	writers := []io.Writer{wc}
+	// content addressed values are named after the digest of their uncompressed data
+	if m.ContentAddressed {
+		v.digest = sha256.New()
+		writers = append(writers, v.digest)
+	}
+	if m.Checksum {
+		v.checksum = crc32.New(crcTable)
+		writers = append(writers, v.checksum)
+	}
+	v.dst = io.MultiWriter(writers...)
+	return v, nil
+}
+
+// abort removes the temp file and returns err
+func (v *stagedValue) abort(err error) error {
+	return cleanUp(v.fsys, v.f, err)
+}
+
+// discard removes the files written by stageFiles
+func (v *stagedValue) discard() {
+	if v.ref != nil {
+		v.ref.Close()
+	}
+	v.fsys.Remove(v.src)
+	if v.expiry != "" {
+		v.fsys.Remove(v.expiry)
+	}
+}
+
+// track records that the file at path is in use by the value until untrack is called
+func (v *stagedValue) track(m *Memoria, path string) {
+	v.untracks = append(v.untracks, m.track(path))
+}
+
+// untrack is called once the files of the value are renamed or removed
+func (v *stagedValue) untrack() {
+	for _, untrack := range v.untracks {
+		untrack()
+	}
+	v.untracks = nil
+}
+
+// flush finishes the compressed stream and closes the temp file
+func (v *stagedValue) flush(sync bool) error {
+	if err := v.wc.Close(); err != nil {
+		return v.abort(fmt.Errorf("Cannot close compression error %w", err))
+	}
+
+	if v.checksum != nil {
+		if err := finishChecksum(v.f, v.checksum); err != nil {
+			return v.abort(fmt.Errorf("Cannot write checksum %w", err))
 		}
-		if err := f.Close(); err != nil {
-			return fmt.Errorf("Cannot close file: %s", err)
+	}
+
+	if sync {
+		if err := v.f.Sync(); err != nil {
+			return v.abort(fmt.Errorf("Cannot Sync: %w", err))
 		}
+	}
 
-		//Atomic Writes: uncomment the following code when implemented atomic writes
-		// fullPath := m.completePath(pathKey)
+	if err := v.f.Close(); err != nil {
+		v.fsys.Remove(v.f.Name())
+		return fmt.Errorf("Cannot close file: %w", err)
+	}
+	return nil
+}
 
-		// if f.Name() != fullPath {
-		// 	if err := os.Rename(f.Name(), fullPath); err != nil {
-		// 		os.Remove(f.Name())
-		// 		return fmt.Errorf("Cannot rename files: %s", err)
-		// 	}
-		// }
+// publish renames the flushed value over the key file. A zero expiresAt removes the
+// expiry of the key, except for appends
+func (m *Memoria) publish(v *stagedValue, sync bool, append bool, expiresAt time.Time) error {
+	// the blob, the reference to it and the expiry are written while the store is
+	// only held for reading, renaming them into place is all the exclusive lock covers
+	m.mu.RLock()
+	err := m.stageFiles(v, expiresAt)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if v.ref != nil {
+		if err := m.finishRef(v, sync); err != nil {
+			return err
+		}
+	}
 
-		// empty the cache for original key
-		m.emptyCacheFor(pathKey.originalKey) // cache is read only
+	m.mu.Lock()
+	err = m.publishWithLock(v, append, expiresAt)
+	m.mu.Unlock()
+	if err != nil {
+		return err
 	}
 
-	if append {
-		f, err := m.createKeyFileWithAppend(pathKey, append)
+	// the rename itself is only durable once the directory entry is synced
+	if sync {
+		if err := syncDir(m.FS, m.pathFor(v.pathKey)); err != nil {
+			return fmt.Errorf("Cannot sync directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// stageFiles writes the files published together with the flushed value, the blob and
+// the reference to it for content addressed stores and the new expiry. The caller must
+// hold the store's mutex for reading
+func (m *Memoria) stageFiles(v *stagedValue, expiresAt time.Time) error {
+	// src is the file renamed over the key file, the reference to the blob for
+	// content addressed stores
+	v.src = v.f.Name()
+	if m.ContentAddressed {
+		digest := hex.EncodeToString(v.digest.Sum(nil))
+		// CollectGarbage leaves the blob alone until its reference is published
+		v.blob = m.blobPath(digest)
+		v.track(m, v.blob)
+		ref, err := m.storeBlob(v.pathKey, v.src, digest)
 		if err != nil {
-			return fmt.Errorf("cannot create key file: %s", err)
+			return fmt.Errorf("Cannot store blob: %w", err)
 		}
+		v.ref, v.src = ref, ref.Name()
+		v.track(m, v.src)
+	}
 
-		// Use the writer directly, handling compression or other transformations here if necessary
-		wc := io.WriteCloser(&nopWriteCloser{f})
+	if !expiresAt.IsZero() {
+		// the key is locked so its expiry stays the one read here
+		var err error
+		if v.oldExpiry, err = m.readExpiry(v.pathKey); err != nil {
+			v.discard()
+			return fmt.Errorf("Cannot read expiry: %w", err)
+		}
+		if v.expiry, err = m.stageExpiry(v.pathKey, expiresAt); err != nil {
+			v.discard()
+			return fmt.Errorf("Cannot write expiry: %w", err)
+		}
+		v.track(m, v.expiry)
+	}
+	return nil
+}
 
-		// Perform the data copy operation
-		if _, err := io.Copy(wc, r); err != nil {
-			return cleanUp(f, fmt.Errorf("Cannot copy from read buffer: %s", err))
+// finishRef syncs the blob and the reference to it when sync is set and closes the
+// reference. The store's mutex is not needed, the blob and the reference are tracked
+// so neither they nor their directories are removed in the meantime
+func (m *Memoria) finishRef(v *stagedValue, sync bool) error {
+	if sync {
+		if err := syncDir(m.FS, filepath.Dir(v.blob)); err != nil {
+			v.discard()
+			return fmt.Errorf("Cannot store blob: %w", err)
 		}
+		if err := v.ref.Sync(); err != nil {
+			v.discard()
+			return fmt.Errorf("Cannot store blob: %w", err)
+		}
+	}
+	err := v.ref.Close()
+	v.ref = nil
+	if err != nil {
+		v.discard()
+		return fmt.Errorf("Cannot store blob: %w", err)
+	}
+	return nil
+}
+
+// publishWithLock renames the staged files into place, the caller must hold the
+// store's mutex
+func (m *Memoria) publishWithLock(v *stagedValue, append bool, expiresAt time.Time) error {
+	pathKey, key := v.pathKey, v.pathKey.originalKey
 
-		// Close the write closer
-		if err := wc.Close(); err != nil {
-			return cleanUp(f, fmt.Errorf("Cannot close file after writing: %s", err))
+	// temp files in Tempdir do not keep the directory of the key from being pruned
+	if err := m.createDirIfMissing(pathKey); err != nil {
+		v.discard()
+		return fmt.Errorf("Cannot create directory: %s", err)
+	}
+
+	// the expiry is renamed first so the new value is never visible without it. The
+	// old expiry is put back when the value cannot be renamed into place
+	if v.expiry != "" {
+		if err := m.FS.Rename(v.expiry, m.expiryPath(pathKey)); err != nil {
+			v.discard()
+			return fmt.Errorf("Cannot write expiry: %w", err)
 		}
+	}
 
-		// Sync if required
-		if sync {
-			if err := f.Sync(); err != nil {
-				cleanUp(f, fmt.Errorf("Cannot sync file: %s", err))
+	if err := m.FS.Rename(v.src, m.completePath(pathKey)); err != nil {
+		m.FS.Remove(v.src)
+		if v.expiry != "" {
+			if v.oldExpiry.IsZero() {
+				m.removeExpiry(pathKey)
+			} else {
+				m.writeExpiry(pathKey, v.oldExpiry)
 			}
 		}
+		return fmt.Errorf("Cannot rename files: %w", err)
+	}
 
-		if err := f.Close(); err != nil {
-			return fmt.Errorf("Cannot close file after sync: %s", err)
+	// the new value is in place from here on, so it is published even when its old
+	// expiry cannot be removed, which then still applies to it
+	var err error
+	if expiresAt.IsZero() && !append {
+		if rerr := m.removeExpiry(pathKey); rerr != nil {
+			err = fmt.Errorf("Cannot remove expiry: %w", rerr)
 		}
+	}
+	if err == nil && (!expiresAt.IsZero() || !append) {
+		m.setExpiry(key, expiresAt)
+	}
 
-		// Empty cache after write if necessary
-		m.emptyCacheFor(pathKey.originalKey)
+	// the version is bumped first so reads of the old value can no longer cache it
+	m.bumpVersion(key)
+	m.uncache(key)
 
+	if m.Index != nil {
+		m.Index.Insert(key)
 	}
 
-	return nil
+	return err
 
 }
 
+// uncache removes the key from the cache
+func (m *Memoria) uncache(key string) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	m.emptyCacheFor(key)
+}
+
+// emptyCacheFor removes the key from the cache, the caller must hold cacheMu
 func (m *Memoria) emptyCacheFor(key string) {
 	if val, ok := m.cache[key]; ok {
 		m.cacheSize -= uint64(len(val))
 		delete(m.cache, key)
+		if observer, ok := m.CachePolicy.(CacheObserver); ok {
+			observer.Remove(m, key)
+		}
 	}
 }
 
+// emptyCache removes every key from the cache, the caller must hold cacheMu
+func (m *Memoria) emptyCache() {
+	for key := range m.cache {
+		m.emptyCacheFor(key)
+	}
+	m.cacheSize = 0
+}
+
 func (m *Memoria) createDirIfMissing(pathkey *PathKey) error {
-	return os.MkdirAll(m.pathFor(pathkey), m.pathPerm)
-}
-
-func (m *Memoria) createKeyFile(pathKey *PathKey) (*os.File, error) {
-	// if m.Tempdir != "" {
-	//TODO: Write implementation here
-	// }
-	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC // defines the mode of operation for creating the file
-	// O_WRONLY: Open for writing only
-	// O_CREATE: Create the file if it does not exist
-	// O_TRUNC: if file exists truncate it to length 0
-	f, err := os.OpenFile(m.completePath(pathKey), mode, m.filePerm) //creates the file
+	return m.FS.MkdirAll(m.pathFor(pathkey), m.pathPerm)
+}
+
+// createKeyFile creates the temp file a value is written to before it is renamed
+// over the key file. Temp files live in Tempdir when set, otherwise next to the key
+// file so the rename never crosses filesystems
+func (m *Memoria) createKeyFile(pathKey *PathKey) (File, error) {
+	dir := m.pathFor(pathKey)
+	if m.Tempdir != "" {
+		if err := m.FS.MkdirAll(m.Tempdir, m.pathPerm); err != nil {
+			return nil, fmt.Errorf("create temp dir: %s", err)
+		}
+		dir = m.Tempdir
+	}
+
+	f, err := m.FS.CreateTemp(dir, tempFilePattern, m.filePerm)
 	if err != nil {
-		return nil, fmt.Errorf("open file: %s", err)
+		return nil, fmt.Errorf("open file: %w", err)
 	}
 	return f, nil
 
 }
 
-func (m *Memoria) createKeyFileWithAppend(pathKey *PathKey, append bool) (*os.File, error) {
-	var mode int
-	if append {
-		mode = os.O_APPEND | os.O_WRONLY
-	} else {
-		mode = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+// copyKeyFile copies the current uncompressed value of the key into dst. Appending
+// to a key which does not exist is an error
+func (m *Memoria) copyKeyFile(dst io.Writer, pathKey *PathKey) error {
+	f, err := m.openValue(pathKey)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %s", m.completePath(pathKey), err)
 	}
+	defer f.Close()
 
-	f, err := os.OpenFile(m.completePath(pathKey), mode, m.filePerm)
+	src, err := m.valueReader(f, pathKey.originalKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %s", m.completePath(pathKey), err)
+		return err
 	}
 
-	return f, nil
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return nil
 }
 
 func (m *Memoria) Read(key string) ([]byte, error) {
@@ -293,100 +638,148 @@ func (m *Memoria) ReadString(key string) (string, error) {
 	return string(val), nil
 }
 
-// ReadStream takes the key and a bool byPassCache to bypass the cache and laziliy
-// delete all the contents of cache for the hit
+// ReadStream takes the key and a bool byPassCache to bypass the cache. A bypassed read
+// removes the key from the cache and caches the value read from disk instead. The
+// returned reader closes the value file at EOF, Close only has to be called by readers
+// which stop early
 
 func (m *Memoria) ReadStream(key string, bypassCache bool) (io.ReadCloser, error) {
-	pathKey := m.transform(key)
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the expiry of cached keys is known so expired keys never leave the cache
+	if m.expired(key) {
+		m.uncache(key)
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	m.cacheMu.Lock()
 	if val, ok := m.cache[key]; ok {
 		if !bypassCache {
+			if observer, ok := m.CachePolicy.(CacheObserver); ok {
+				observer.Hit(m, key)
+			}
+			m.cacheMu.Unlock()
+			// the cache always holds uncompressed values
 			buf := bytes.NewReader(val)
-			//COMPRESSION: make this the compression reader in case of compression
 			return io.NopCloser(buf), nil
 		}
-		go func() {
-			m.mu.Lock()
-			defer m.mu.Unlock()
-			m.cacheSize -= uint64(len(val))
-			delete(m.cache, key)
-		}()
+		m.emptyCacheFor(key)
 	}
+	m.cacheMu.Unlock()
 
 	// read the file from disk in case of cache miss or bypass cache
-	fileName := m.completePath(pathKey)
-
-	//TODO: first check whether filename is valid or not to return appropiate error
-	// use os.Stat
-	f, err := os.Open(fileName)
 
+	expiresAt, err := m.readExpiry(pathKey)
 	if err != nil {
-		return nil, fmt.Errorf("Cannot open file %s", err)
+		return nil, fmt.Errorf("Cannot read expiry %s", err)
+	}
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 	}
+	m.setExpiry(key, expiresAt)
 
-	var r io.Reader
+	f, err := m.openValue(pathKey)
 
-	if m.MaxCacheSize > 0 {
-		r = newCachingReader(f, m, key)
-	} else {
-		r = &closingReader{f}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		return nil, fmt.Errorf("Cannot open file: %w", err)
 	}
 
-	var rc = io.ReadCloser(io.NopCloser(r))
+	dr, err := m.valueReader(f, key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Cannot create decompression reader %w", err)
+	}
 
-	return rc, nil
+	if m.MaxCacheSize > 0 {
+		// writers are held off so this is the version of the file just opened
+		return newCachingReader(f, dr, m, key, m.watch(key)), nil
+	}
+	return &closingReader{rc: readCloser{dr, f}}, nil
 }
 
 // closingReader provides a Reader that automatically closes the
 // embedded ReadCloser when it reaches EOF
 type closingReader struct {
-	rc io.ReadCloser
+	rc     io.ReadCloser
+	closed bool
 }
 
-func (cr closingReader) Read(p []byte) (int, error) {
+func (cr *closingReader) Read(p []byte) (int, error) {
 	n, err := cr.rc.Read(p)
 	if err == io.EOF {
-		if closeErr := cr.rc.Close(); closeErr != nil {
+		if closeErr := cr.Close(); closeErr != nil {
 			return n, closeErr // close must succeed for Read to succeed
 		}
 	}
 	return n, err
 }
 
+// Close closes the embedded ReadCloser unless it was already closed at EOF
+func (cr *closingReader) Close() error {
+	if cr.closed {
+		return nil
+	}
+	cr.closed = true
+	return cr.rc.Close()
+}
+
+// readCloser joins a reader with the closer of its underlying file
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
 // this denotes a reader which also caches the data as it reads this in case when size
 // of the cache is greater than 0
 type cachingReader struct {
-	f   *os.File
+	f   File
+	r   io.Reader // the uncompressed contents of f
 	m   *Memoria
 	key string
 	buf *bytes.Buffer
+	// version of the key when f was opened, the value is not cached if the key
+	// was written while it was being read. The key is watched until Close
+	version uint64
+	closed  bool
 }
 
-func newCachingReader(f *os.File, m *Memoria, key string) io.Reader {
+func newCachingReader(f File, r io.Reader, m *Memoria, key string, version uint64) io.ReadCloser {
 	return &cachingReader{
-		f:   f,
-		m:   m,
-		key: key,
-		buf: &bytes.Buffer{},
+		f:       f,
+		r:       r,
+		m:       m,
+		key:     key,
+		buf:     &bytes.Buffer{},
+		version: version,
 	}
 }
 
 // read interface for io.Reader
 func (c *cachingReader) Read(p []byte) (int, error) {
-	n, err := c.f.Read(p)
+	n, err := c.r.Read(p)
 
-	if err == nil {
-		return c.buf.Write(p[0:n]) // write must succedd for read to succed
+	// decompressors may return the last bytes together with io.EOF
+	if n > 0 {
+		if _, werr := c.buf.Write(p[0:n]); werr != nil {
+			return n, werr // write must succedd for read to succed
+		}
 	}
 
 	if err == io.EOF {
-		if err := c.m.cacheWithoutLock(c.key, c.buf.Bytes()); err != nil {
-			return n, err
-		} // cache may fail
+		// cache may fail, for example when the value is larger than the cache, which
+		// must not fail the read itself
+		c.m.cacheVersionWithoutLock(c.key, c.buf.Bytes(), c.version)
 
-		if closeErr := c.f.Close(); closeErr != nil {
+		if closeErr := c.Close(); closeErr != nil {
 			return n, closeErr
 		}
 	}
@@ -395,6 +788,261 @@ func (c *cachingReader) Read(p []byte) (int, error) {
 
 }
 
+// Close closes the value file. Values which were not read to EOF are not cached
+func (c *cachingReader) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.m.unwatch(c.key)
+	return c.f.Close()
+}
+
+// Has returns true if the key exists in the store. The value itself is not read
+func (m *Memoria) Has(key string) bool {
+	if len(key) <= 0 {
+		return false
+	}
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, err := m.FS.Stat(m.completePath(pathKey))
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	expiresAt, err := m.readExpiry(pathKey)
+	if err != nil {
+		return false
+	}
+	return expiresAt.IsZero() || time.Now().Before(expiresAt)
+}
+
+// Erase removes the key from the disk and the cache. Directories left empty by the
+// PathTransform are removed as well. Returns ErrKeyNotFound if the key does not exist
+func (m *Memoria) Erase(key string) error {
+	if len(key) <= 0 {
+		return fmt.Errorf("Empty key")
+	}
+
+	unlock, err := m.lockWrite(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return m.eraseKeyLocked(key)
+}
+
+// eraseKeyLocked is Erase for a key the caller has locked with lockWrite
+func (m *Memoria) eraseKeyLocked(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.eraseWithLock(key)
+}
+
+// eraseWithLock erases the key, the caller must hold the store's mutex
+func (m *Memoria) eraseWithLock(key string) error {
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return err
+	}
+
+	fileName := m.completePath(pathKey)
+	info, err := m.FS.Stat(fileName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		return fmt.Errorf("Cannot stat file: %s", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	if err := m.FS.Remove(fileName); err != nil {
+		return fmt.Errorf("Cannot remove file: %s", err)
+	}
+
+	if err := m.forgetKey(key, pathKey); err != nil {
+		return err
+	}
+
+	m.pruneDirs(m.pathFor(pathKey))
+	return nil
+}
+
+// forgetKey drops the expiry, cached value and index entry of a key whose file was
+// removed, the caller must hold the store's mutex
+func (m *Memoria) forgetKey(key string, pathKey *PathKey) error {
+	if err := m.removeExpiry(pathKey); err != nil {
+		return fmt.Errorf("Cannot remove expiry: %s", err)
+	}
+	m.setExpiry(key, time.Time{})
+	// the version is bumped first so reads of the old value can no longer cache it
+	m.bumpVersion(key)
+	m.uncache(key)
+
+	if m.Index != nil {
+		m.Index.Delete(key)
+	}
+	return nil
+}
+
+// EraseAll removes every key from the disk and empties the cache. Basedir itself is kept
+func (m *Memoria) EraseAll() error {
+	if err := m.checkWritable(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bumpAllVersions()
+	m.cacheMu.Lock()
+	m.emptyCache()
+	m.cacheMu.Unlock()
+	m.clearExpiries()
+
+	if m.Index != nil {
+		empty := make(chan string)
+		close(empty)
+		m.Index.Initialize(empty)
+	}
+
+	entries, err := m.FS.ReadDir(m.Basedir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("Cannot read base directory: %s", err)
+	}
+
+	for _, entry := range entries {
+		// the write-ahead log and the lock files belong to the store rather than its contents
+		switch entry.Name() {
+		case walDirName, storeLockName, writerLockName, keyLockDirName:
+			continue
+		}
+		if err := m.FS.RemoveAll(filepath.Join(m.Basedir, entry.Name())); err != nil {
+			return fmt.Errorf("Cannot remove %s: %s", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Keys returns a channel that yields every key in the store. The keys are rebuilt
+// from the files in Basedir with the InversePathTransform so nothing is loaded into
+// memory up front. Expired keys are skipped like Has does. Closing cancel stops the walk
+// and closes the channel
+func (m *Memoria) Keys(cancel <-chan struct{}) <-chan string {
+	return m.KeysPrefix("", cancel)
+}
+
+// KeysPrefix is like Keys but only yields the keys starting with prefix
+func (m *Memoria) KeysPrefix(prefix string, cancel <-chan struct{}) <-chan string {
+	c := make(chan string)
+	go func() {
+		defer close(c)
+		m.walkKeys(func(key string) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return true
+			}
+			select {
+			case c <- key:
+				return true
+			case <-cancel:
+				return false
+			}
+		})
+	}()
+	return c
+}
+
+// walkKeys walks Basedir and calls fn with the key of every value file found.
+// Internal files and expired keys are skipped. The walk stops when fn returns false
+func (m *Memoria) walkKeys(fn func(key string) bool) error {
+	now := time.Now()
+	return m.walkPaths(func(key, path string) bool {
+		return m.expiredFile(path, now) || fn(key)
+	})
+}
+
+// walkPaths walks Basedir and calls fn with the key and path of every value file
+// found, expired or not. Internal files are skipped. The walk stops when fn returns false
+func (m *Memoria) walkPaths(fn func(key, path string) bool) error {
+	base := filepath.Clean(m.Basedir)
+	tempdir := ""
+	if m.Tempdir != "" {
+		tempdir = filepath.Clean(m.Tempdir)
+	}
+
+	err := walkDir(m.FS, base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// a missing Basedir simply has no keys
+			if path == base && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path == tempdir || (path != base && isInternalFile(d.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isInternalFile(d.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		if !fn(m.InverseTransform(pathKeyFor(rel)), path) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return err
+}
+
+// pathKeyFor builds the PathKey of a file from its path relative to Basedir
+func pathKeyFor(rel string) *PathKey {
+	dir, file := filepath.Split(rel)
+	pathKey := &PathKey{Path: []string{}, FileName: file}
+	if dir = strings.Trim(dir, string(filepath.Separator)); dir != "" {
+		pathKey.Path = strings.Split(dir, string(filepath.Separator))
+	}
+	return pathKey
+}
+
+// isInternalFile reports whether name is a file or directory memoria uses for its
+// own bookkeeping rather than a value
+func isInternalFile(name string) bool {
+	return name == dumpFileName || strings.HasPrefix(name, internalPrefix)
+}
+
+// pruneDirs removes dir and its parents up to Basedir as long as they are empty
+func (m *Memoria) pruneDirs(dir string) {
+	base := filepath.Clean(m.Basedir)
+	for dir = filepath.Clean(dir); dir != base; dir = filepath.Dir(dir) {
+		if !strings.HasPrefix(dir, base+string(filepath.Separator)) {
+			return
+		}
+		// Remove fails on directories which are not empty which ends the pruning
+		if err := m.FS.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
 func (m *Memoria) pathFor(pathkey *PathKey) string {
 	return filepath.Join(m.Basedir, filepath.Join(pathkey.Path...))
 }
@@ -402,7 +1050,7 @@ func (m *Memoria) completePath(path *PathKey) string {
 	return filepath.Join(m.pathFor(path), path.FileName)
 }
 
-// cache the give key-value pain
+// cache the give key-value pain, the caller must hold cacheMu
 func (m *Memoria) cacheWithLock(key string, val []byte) error {
 	m.emptyCacheFor(key) // remove the cache if it already exists
 
@@ -412,7 +1060,7 @@ func (m *Memoria) cacheWithLock(key string, val []byte) error {
 		return fmt.Errorf("%s; cannot cache", err)
 	}
 
-	if err := m.cachePolicy.Insert(m, key, val); err != nil {
+	if err := m.CachePolicy.Insert(m, key, val); err != nil {
 		return fmt.Errorf("%s; cannot insert", err)
 	}
 	return nil
@@ -422,15 +1070,23 @@ func (m *Memoria) makeSpace(valueSize uint64) error {
 	if valueSize > m.MaxCacheSize {
 		return fmt.Errorf("value size (%d bytes) is too large for cache (%d bytes)", valueSize, m.MaxCacheSize)
 	}
+	if m.cacheSize+valueSize <= m.MaxCacheSize {
+		return nil // the value already fits
+	}
 	// how much space we need
 	spaceNeeded := (m.cacheSize + valueSize) - m.MaxCacheSize
-	return m.cachePolicy.Eject(m, spaceNeeded)
+	return m.CachePolicy.Eject(m, spaceNeeded)
 }
 
-// aquires the store's mutex and calls Lock
-func (m *Memoria) cacheWithoutLock(key string, val []byte) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// aquires the cache's mutex and caches the value if the key is still at the
+// given version, otherwise the value is stale and is dropped. Writers bump the version
+// before they remove the key from the cache so a stale value is never left behind
+func (m *Memoria) cacheVersionWithoutLock(key string, val []byte, version uint64) error {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	if m.version(key) != version {
+		return nil
+	}
 	return m.cacheWithLock(key, val)
 }
 
@@ -444,15 +1100,28 @@ type nopWriteCloser struct {
 func (wc *nopWriteCloser) Write(p []byte) (int, error) { return wc.Writer.Write(p) }
 func (wc *nopWriteCloser) Close() error                { return nil }
 
-// /// HELPER FUNCTIONS REFACTOR PLEASE!
-func cleanUp(file *os.File, onCleanUpError error) error {
+// cleanUp closes and removes the temp file after onCleanUpError. The file is removed even
+// if closing it fails, and the returned error wraps onCleanUpError together with any
+// error of the clean up itself
+func cleanUp(fsys FS, file File, onCleanUpError error) error {
+	errs := []error{onCleanUpError}
 	if err := file.Close(); err != nil {
-		return fmt.Errorf("Cannot close file while cleanup:  %s", err)
+		errs = append(errs, fmt.Errorf("Cannot close file while cleanup: %w", err))
+	}
+	if err := fsys.Remove(file.Name()); err != nil {
+		errs = append(errs, fmt.Errorf("Cannot remove file while cleanup: %w", err))
 	}
-	if err := os.Remove(file.Name()); err != nil {
-		return fmt.Errorf("Cannot remoave file while cleanup: %s", err)
+	return errors.Join(errs...)
+}
+
+// syncDir flushes the directory entries of dir to disk
+func syncDir(fsys FS, dir string) error {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("%s ..Files Cleaned!", onCleanUpError)
+	defer d.Close()
+	return d.Sync()
 }
 
 // Implementing Concurrent Bulk Write Operations using Go Routines
@@ -462,142 +1131,100 @@ type WriteResult struct {
 	Error error
 }
 
+// BulkWrite writes the pairs using numWorkers goroutines, one per CPU when numWorkers <= 0,
+// and returns the results sorted by key. When the store has a write-ahead log the pairs
+// are logged as one batch first, so after a crash they are either all written or none of
+// them are. A batch in which a write fails is aborted in the log, see WriteBatch
 func (m *Memoria) BulkWrite(pairs map[string][]byte, numWorkers int) []WriteResult { // I've taken the number of workers as an argument so that we've a control over how many goroutines we wanna use
-
-	var wg sync.WaitGroup
-	results := make([]WriteResult, 0, len(pairs)) //To store results of each write op and also I've kept its size equal to no. of pairs
-
-	// Channel for Worker Pool
-	workChan := make(chan struct {
-		key   string
-		value []byte
-	}, len(pairs))
-
-	//Creating channel for goroutines
-	resultChan := make(chan WriteResult, len(pairs)) //Hence, the Buffer size in channel is equal to the no. of pairs
-
-	// Worker pool
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for task := range workChan {
-				err := m.Write(task.key, task.value)
-				resultChan <- WriteResult{
-					Key:   task.key,
-					Error: err,
-				}
-			}
-		}()
-	}
-
-	// Feeding tasks to the work channel
-	go func() {
-		for key, value := range pairs {
-			workChan <- struct {
-				key   string
-				value []byte
-			}{key, value}
-		}
-		close(workChan) // To close the work channel once all tasks are fed
-	}()
-
-	go func() {
-		wg.Wait()
-		close(resultChan) //To close the channel once all the goroutines are completed
-	}()
-
-	for result := range resultChan {
-		results = append(results, result)
-	}
-
-	return results
-
+	return m.BulkWriteCtx(context.Background(), pairs, numWorkers)
 }
 
-// Implementing the Close() method:
-
-func (m *Memoria) Close() error { // Here, the Close() method only clears the in-memory cache
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Clearing the cache within the memory:
-	for key := range m.cache {
-		delete(m.cache, key) // To delete the key from cache map
+// BulkWriteCtx is BulkWrite which stops once ctx is done. Writes in progress are stopped
+// like WriteStreamCtx and the workers take no new pairs, the keys which were never
+// written are reported with ErrNotAttempted. With a write-ahead log a batch which was
+// stopped part way is aborted in the log, so Open never writes the keys which were not
+// attempted
+func (m *Memoria) BulkWriteCtx(ctx context.Context, pairs map[string][]byte, numWorkers int) []WriteResult {
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
 	}
-	m.cacheSize = 0
+	sort.Strings(keys)
 
-	return nil
-}
-
-// createdump method
-func (m *Memoria) createDump() error {
-	// buffer to hold the dump data
-	var buf bytes.Buffer
-
-	// writer to serialize the key-value data into the buffer.
-	encoder := json.NewEncoder(&buf)
-
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	results := make([]WriteResult, len(keys)) //To store results of each write op and also I've kept its size equal to no. of pairs
+	for i, key := range keys {
+		results[i].Key = key
+	}
 
-	for key, value := range m.cache {
-		// Write key-value pairs into the buffer
-		if err := encoder.Encode(map[string][]byte{key: value}); err != nil {
-			return fmt.Errorf("failed to encode key-value pair %s: %v", key, err)
+	// nothing is logged for a batch which is not attempted at all
+	if err := ctx.Err(); err != nil {
+		for i := range results {
+			results[i].Error = notAttempted(err)
 		}
+		return results
 	}
 
-	dumpFilePath := filepath.Join(m.Basedir, "backup.dump")
-	file, err := os.Create(dumpFilePath)
+	seq, err := m.logPairs(pairs)
 	if err != nil {
-		return fmt.Errorf("failed to create dump file: %v", err)
+		for i := range results {
+			results[i].Error = err
+		}
+		return results
 	}
-	defer file.Close()
 
-	if _, err := buf.WriteTo(file); err != nil {
-		return fmt.Errorf("failed to write dump data to file: %v", err)
+	errs := runWorkers(ctx, len(keys), numWorkers, func(i int) error {
+		return m.WriteStreamCtx(ctx, keys[i], bytes.NewReader(pairs[keys[i]]), false, m.walSync())
+	})
+
+	failed, stopped := false, false
+	for i, err := range errs {
+		results[i].Error = err
+		switch {
+		case errors.Is(err, ErrNotAttempted):
+			stopped = true
+		case err != nil && len(keys[i]) > 0 && !errors.Is(err, ErrInvalidKey):
+			failed = true
+		}
 	}
 
-	return nil
-}
+	// a batch which failed or was stopped part way is never applied again by Open
+	switch {
+	case seq == 0:
+	case failed || stopped:
+		if err := m.wal.abort(seq); err != nil {
+			for i := range results {
+				if results[i].Error != nil {
+					results[i].Error = errors.Join(results[i].Error, fmt.Errorf("Cannot abort batch: %w", err))
+				}
+			}
+		}
+	default:
+		m.wal.commit(seq)
+	}
 
-// Backup mrthod restores the store's data from a backup file located in the given directory.
-func (m *Memoria) Backup(backupDir string) error {
-	// Construct path to the dump file that needs to be restored
-	dumpFilePath := filepath.Join(backupDir, "backup.dump")
+	return results
 
-	// Open the backup dump file
-	file, err := os.Open(dumpFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to open backup dump file: %v", err)
-	}
-	defer file.Close()
+}
 
-	// Read the contents of the file into a buffer
-	var buf bytes.Buffer
-	if _, err := buf.ReadFrom(file); err != nil {
-		return fmt.Errorf("failed to read from backup dump file: %v", err)
-	}
+// Implementing the Close() method:
 
-	// Decode the backup data into memory
-	decoder := json.NewDecoder(&buf)
-	for {
-		var data map[string][]byte
-		if err := decoder.Decode(&data); err != nil {
-			if err == io.EOF {
-				break // End of the backup file
-			}
-			return fmt.Errorf("failed to decode backup data: %v", err)
+func (m *Memoria) Close() error { // Here, the Close() method stops the sweeper, closes the log and clears the in-memory cache
+	var err error
+	m.closeOnce.Do(func() {
+		m.stopSweeping()
+		if m.wal != nil {
+			err = m.wal.close()
 		}
-
-		// Insert each key-value pair back into the memory store
-		for key, value := range data {
-			m.mu.Lock()
-			m.cache[key] = value
-			m.mu.Unlock()
+		if lerr := m.storeLock.release(); lerr != nil && err == nil {
+			err = lerr
 		}
-	}
+	})
 
-	return nil
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	// Clearing the cache within the memory:
+	m.emptyCache()
+
+	return err
 }
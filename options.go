@@ -0,0 +1,178 @@
+package memoria
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Option changes a setting of the Options passed to Open
+type Option func(o *Options)
+
+// WithDir sets the base directory of the store
+func WithDir(dir string) Option {
+	return func(o *Options) { o.Basedir = dir }
+}
+
+// WithCacheSize sets the maximum size of the cache in bytes
+func WithCacheSize(size uint64) Option {
+	return func(o *Options) { o.MaxCacheSize = size }
+}
+
+// WithCachePolicy sets the policy deciding which keys are ejected from the cache
+func WithCachePolicy(policy CachePolicy) Option {
+	return func(o *Options) { o.CachePolicy = policy }
+}
+
+// WithCompression sets the compression used for values written to disk
+func WithCompression(compression Compression) Option {
+	return func(o *Options) { o.Compression = compression }
+}
+
+// WithFilePerm sets the permissions of the value files
+func WithFilePerm(perm os.FileMode) Option {
+	return func(o *Options) { o.filePerm = perm }
+}
+
+// WithPathPerm sets the permissions of the directories created by the store
+func WithPathPerm(perm os.FileMode) Option {
+	return func(o *Options) { o.pathPerm = perm }
+}
+
+// WithBufferSize sets the size of the buffer values are copied through
+func WithBufferSize(size int) Option {
+	return func(o *Options) { o.bufferSize = size }
+}
+
+// WithSweepInterval sets how often expired keys are deleted in the background
+func WithSweepInterval(interval time.Duration) Option {
+	return func(o *Options) { o.SweepInterval = interval }
+}
+
+// WithWAL enables the write-ahead log with the given sync policy
+func WithWAL(policy WALSyncPolicy) Option {
+	return func(o *Options) {
+		o.WAL = true
+		o.WALSync = policy
+	}
+}
+
+// WithPathTransform sets how keys are mapped to files and back, see ShardedTransform
+// and HashedTransform
+func WithPathTransform(transform PathTransform, inverse InversePathTransform) Option {
+	return func(o *Options) {
+		o.PathTransform = transform
+		o.InversePathTransform = inverse
+	}
+}
+
+// WithContentAddressing stores identical values once, see Options.ContentAddressed
+func WithContentAddressing() Option {
+	return func(o *Options) { o.ContentAddressed = true }
+}
+
+// WithChecksums stores a checksum with every value, see Options.Checksum
+func WithChecksums() Option {
+	return func(o *Options) { o.Checksum = true }
+}
+
+// WithLock locks Basedir with the mode when the store is opened
+func WithLock(mode LockMode) Option {
+	return func(o *Options) { o.Lock = mode }
+}
+
+// WithFS sets the filesystem the store keeps its files in, see Options.FS
+func WithFS(fsys FS) Option {
+	return func(o *Options) { o.FS = fsys }
+}
+
+// Open applies the options to o, creates the base directory if it is missing and checks
+// that it can be written to before returning the store. Unlike New every problem with
+// the directory is reported here rather than on the first write
+func Open(o Options, opts ...Option) (*Memoria, error) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.Basedir == "" {
+		o.Basedir = defaultBaseDir
+	}
+	if o.pathPerm == 0 {
+		o.pathPerm = defaultPathPerm
+	}
+	if o.FS == nil {
+		o.FS = NewOSFS()
+	}
+	if o.bufferSize < 0 {
+		return nil, fmt.Errorf("invalid buffer size %d", o.bufferSize)
+	}
+
+	// a store opened read only never writes, so its directories only have to exist
+	readOnly := o.Lock == LockReadOnly || isReadOnlyFS(o.FS)
+	if err := checkDir(o.FS, o.Basedir, o.pathPerm, readOnly); err != nil {
+		return nil, err
+	}
+	if o.Tempdir != "" && !readOnly {
+		if err := checkDir(o.FS, o.Tempdir, o.pathPerm, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.WAL && (o.Lock == LockReadOnly || isReadOnlyFS(o.FS)) {
+		return nil, fmt.Errorf("the write-ahead log cannot be replayed into a read only store")
+	}
+	// flock needs the file descriptors of the operating system
+	if o.Lock != LockNone && !isOSFS(o.FS) {
+		return nil, fmt.Errorf("lock mode %s needs the filesystem of the operating system", o.Lock)
+	}
+	filePerm := o.filePerm
+	if filePerm == 0 {
+		filePerm = defaultFilePerm
+	}
+	lock, err := acquireStoreLock(o.Basedir, o.Lock, filePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	m := New(o)
+	m.storeLock = lock
+	if m.WAL {
+		if err := m.openWAL(); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// checkDir creates dir if it is missing and verifies it is a writable directory. The
+// directories of a store opened readOnly only have to exist
+func checkDir(fsys FS, dir string, perm os.FileMode, readOnly bool) error {
+	if !readOnly {
+		if err := fsys.MkdirAll(dir, perm); err != nil {
+			return fmt.Errorf("cannot create directory %s: %w", dir, err)
+		}
+	}
+
+	info, err := fsys.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cannot stat directory %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	if readOnly {
+		return nil
+	}
+
+	f, err := fsys.CreateTemp(dir, tempFilePattern, 0600)
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	f.Close()
+	if err := fsys.Remove(f.Name()); err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package memoria
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// readOnlyFS serves the files of an fs.FS, every write fails with ErrReadOnly
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+// NewReadOnlyFS returns an FS reading the files of fsys, for example a store embedded
+// in the binary with embed.FS. Basedir must be a path inside fsys such as "." or
+// "data". Every write fails with ErrReadOnly and the sweeper is not started
+func NewReadOnlyFS(fsys fs.FS) FS {
+	return readOnlyFS{fsys: fsys}
+}
+
+// isReadOnlyFS reports whether fsys is an FS returned by NewReadOnlyFS
+func isReadOnlyFS(fsys FS) bool {
+	_, ok := fsys.(readOnlyFS)
+	return ok
+}
+
+// path returns name as a path of the fs.FS
+func (r readOnlyFS) path(op, name string) (string, error) {
+	path := filepath.ToSlash(filepath.Clean(name))
+	if !fs.ValidPath(path) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path, nil
+}
+
+func (r readOnlyFS) Open(name string) (File, error) {
+	path, err := r.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := r.fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{File: f, name: name}, nil
+}
+
+func (r readOnlyFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrReadOnly}
+	}
+	return r.Open(name)
+}
+
+func (r readOnlyFS) CreateTemp(dir, pattern string, perm os.FileMode) (File, error) {
+	return nil, &fs.PathError{Op: "createtemp", Path: filepath.Join(dir, pattern), Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) MkdirTemp(dir, pattern string) (string, error) {
+	return "", &fs.PathError{Op: "mkdirtemp", Path: filepath.Join(dir, pattern), Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) MkdirAll(path string, perm os.FileMode) error {
+	// directories which already exist need no writing
+	if info, err := r.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	return &fs.PathError{Op: "mkdir", Path: path, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) RemoveAll(path string) error {
+	return &fs.PathError{Op: "removeall", Path: path, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Rename(oldpath, newpath string) error {
+	return &fs.PathError{Op: "rename", Path: oldpath, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Link(oldname, newname string) error {
+	return &fs.PathError{Op: "link", Path: newname, Err: ErrReadOnly}
+}
+
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := r.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(r.fsys, path)
+}
+
+// Lstat is Stat, fs.FS does not expose symbolic links
+func (r readOnlyFS) Lstat(name string) (fs.FileInfo, error) {
+	return r.Stat(name)
+}
+
+func (r readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := r.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(r.fsys, path)
+}
+
+// readOnlyFile is a file of a readOnlyFS
+type readOnlyFile struct {
+	fs.File
+	name string
+}
+
+func (f *readOnlyFile) Name() string {
+	return f.name
+}
+
+func (f *readOnlyFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *readOnlyFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &fs.PathError{Op: "writeat", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *readOnlyFile) Truncate(size int64) error {
+	return &fs.PathError{Op: "truncate", Path: f.name, Err: ErrReadOnly}
+}
+
+func (f *readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+}
+
+// Sync does nothing, nothing is ever written to the file
+func (f *readOnlyFile) Sync() error {
+	return nil
+}
@@ -0,0 +1,359 @@
+package memoria
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Snapshots are a stream of
+//
+//	header:  "MEMSNAP\x00" | version (uint16)
+//	entries: len(key) (uvarint) | key | expiry in unix nanoseconds, 0 for none (varint) |
+//	         value chunks of len (uvarint) | bytes, ended by a zero length chunk
+//	trailer: 0 (uvarint, an empty key) | number of entries (uint64) |
+//	         CRC-32C of everything before it (uint32)
+//
+// Integers are little endian. The checksum comes last so values can be streamed
+// without knowing their size up front
+const (
+	snapshotMagic   = "MEMSNAP\x00"
+	snapshotVersion = 1
+
+	snapshotDirPattern = internalPrefix + "snapshot-*"
+	restoreDirPattern  = internalPrefix + "restore-*"
+	snapshotChunkSize  = 32 * 1024
+)
+
+// ErrBadSnapshot is returned by Restore for streams which are not a valid snapshot
+var ErrBadSnapshot = errors.New("bad snapshot")
+
+type snapshotEntry struct {
+	key       string
+	expiresAt time.Time
+	source    string // the file holding the value in the store
+	path      string // the file the value is read from
+}
+
+// Snapshot writes every key on disk with its value and expiry to w. The snapshot is a
+// consistent view of the store: the value files are hard linked while writes are held
+// off, so writes can continue while the values are streamed. On filesystems without hard
+// links, or where Basedir cannot be written, writes wait until the snapshot is written
+func (m *Memoria) Snapshot(w io.Writer) error {
+	// the values of a read only FS cannot change, they are read where they are
+	dir := ""
+	if !isReadOnlyFS(m.FS) {
+		var err error
+		if dir, err = m.FS.MkdirTemp(m.Basedir, snapshotDirPattern); err == nil {
+			defer m.track(dir)()
+			defer m.FS.RemoveAll(dir)
+		}
+		// without a directory to link them into the values are read in place
+	}
+
+	m.mu.RLock()
+	entries, linked, err := m.collectSnapshot(dir)
+	if linked {
+		m.mu.RUnlock()
+	} else {
+		defer m.mu.RUnlock()
+	}
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.New(crcTable)
+	bw := bufio.NewWriter(w)
+	sw := io.MultiWriter(bw, crc)
+
+	header := binary.LittleEndian.AppendUint16([]byte(snapshotMagic), snapshotVersion)
+	if _, err := sw.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, snapshotChunkSize)
+	for _, entry := range entries {
+		if err := m.writeSnapshotEntry(sw, entry, buf); err != nil {
+			return fmt.Errorf("cannot snapshot %s: %w", entry.key, err)
+		}
+	}
+
+	trailer := binary.AppendUvarint(nil, 0)
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(len(entries)))
+	if _, err := sw.Write(trailer); err != nil {
+		return err
+	}
+	if _, err := bw.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// collectSnapshot lists every live key with its expiry and hard links its value file
+// into dir. When linking is not supported, or dir is empty, the entries point at the value
+// files instead and the caller has to hold the lock while reading them
+func (m *Memoria) collectSnapshot(dir string) ([]snapshotEntry, bool, error) {
+	entries := []snapshotEntry{}
+	linked := dir != ""
+	now := time.Now()
+
+	err := m.walkKeyFiles(func(key, path string) error {
+		pathKey, err := m.transform(key)
+		if err != nil {
+			return err
+		}
+		expiresAt, err := m.readExpiry(pathKey)
+		if err != nil {
+			return err
+		}
+		if !expiresAt.IsZero() && !now.Before(expiresAt) {
+			return nil
+		}
+
+		source, err := m.valueFile(path)
+		if err != nil {
+			return err
+		}
+
+		entry := snapshotEntry{key: key, expiresAt: expiresAt, source: source, path: source}
+		if linked {
+			link := filepath.Join(dir, strconv.Itoa(len(entries)))
+			if err := m.FS.Link(source, link); err == nil {
+				entry.path = link
+			} else {
+				linked = false
+				// values linked so far are read from the store as well
+				for i := range entries {
+					entries[i].path = entries[i].source
+				}
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, linked, fmt.Errorf("cannot list keys: %w", err)
+	}
+	return entries, linked, nil
+}
+
+func (m *Memoria) writeSnapshotEntry(w io.Writer, entry snapshotEntry, buf []byte) error {
+	expiry := int64(0)
+	if !entry.expiresAt.IsZero() {
+		expiry = entry.expiresAt.UnixNano()
+	}
+	header := binary.AppendUvarint(nil, uint64(len(entry.key)))
+	header = append(header, entry.key...)
+	header = binary.AppendVarint(header, expiry)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	f, err := m.FS.Open(entry.path)
+	if err != nil {
+		if m.ContentAddressed {
+			return missingBlob(err, entry.key)
+		}
+		return err
+	}
+	defer f.Close()
+
+	r, err := m.valueReader(f, entry.key)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := binary.AppendUvarint(nil, uint64(n))
+			if _, werr := w.Write(chunk); werr != nil {
+				return werr
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(binary.AppendUvarint(nil, 0))
+	return err
+}
+
+// Restore writes every key of a snapshot written by Snapshot into the store through
+// the normal write path. Keys which are not in the snapshot are kept. The snapshot is
+// staged on disk and its checksum verified before any key is written, so a truncated or
+// corrupt snapshot leaves the store untouched
+func (m *Memoria) Restore(r io.Reader) error {
+	if err := m.checkWritable(); err != nil {
+		return err
+	}
+
+	dir, err := m.FS.MkdirTemp(m.Basedir, restoreDirPattern)
+	if err != nil {
+		return fmt.Errorf("cannot create restore directory: %s", err)
+	}
+	defer m.track(dir)()
+	defer m.FS.RemoveAll(dir)
+
+	entries, err := stageSnapshot(m.FS, r, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		f, err := m.FS.Open(entry.path)
+		if err != nil {
+			return fmt.Errorf("cannot restore %s: %w", entry.key, err)
+		}
+		err = m.writeStream(entry.key, f, false, false, entry.expiresAt)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("cannot restore %s: %w", entry.key, err)
+		}
+	}
+	return nil
+}
+
+// stageSnapshot decodes the snapshot into one file per value in dir and verifies it
+func stageSnapshot(fsys FS, r io.Reader, dir string) ([]snapshotEntry, error) {
+	br := bufio.NewReader(r)
+	hr := &hashingReader{r: br, h: crc32.New(crcTable)}
+
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(hr, header); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: missing header", ErrBadSnapshot)
+	}
+	if version := binary.LittleEndian.Uint16(header[len(snapshotMagic):]); version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrBadSnapshot, version)
+	}
+
+	entries := []snapshotEntry{}
+	buf := make([]byte, snapshotChunkSize)
+	for {
+		keyLen, err := binary.ReadUvarint(hr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+		}
+		if keyLen == 0 {
+			break
+		}
+		entry, err := stageSnapshotEntry(fsys, hr, dir, keyLen, len(entries), buf)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	count := make([]byte, 8)
+	if _, err := io.ReadFull(hr, count); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+	}
+	sum := hr.h.Sum32()
+
+	checksum := make([]byte, 4)
+	if _, err := io.ReadFull(br, checksum); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+	}
+	if binary.LittleEndian.Uint32(checksum) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+	if binary.LittleEndian.Uint64(count) != uint64(len(entries)) {
+		return nil, fmt.Errorf("%w: entry count mismatch", ErrBadSnapshot)
+	}
+	return entries, nil
+}
+
+func stageSnapshotEntry(fsys FS, hr *hashingReader, dir string, keyLen uint64, n int, buf []byte) (snapshotEntry, error) {
+	if keyLen > uint64(len(buf)) {
+		return snapshotEntry{}, fmt.Errorf("%w: key too long", ErrBadSnapshot)
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(hr, key); err != nil {
+		return snapshotEntry{}, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+	}
+	expiry, err := binary.ReadVarint(hr)
+	if err != nil {
+		return snapshotEntry{}, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+	}
+
+	entry := snapshotEntry{key: string(key), path: filepath.Join(dir, strconv.Itoa(n))}
+	if expiry != 0 {
+		entry.expiresAt = time.Unix(0, expiry)
+	}
+
+	f, err := fsys.OpenFile(entry.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return snapshotEntry{}, err
+	}
+	defer f.Close()
+
+	for {
+		size, err := binary.ReadUvarint(hr)
+		if err != nil {
+			return snapshotEntry{}, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+		}
+		if size == 0 {
+			break
+		}
+		if size > uint64(len(buf)) {
+			return snapshotEntry{}, fmt.Errorf("%w: chunk too large", ErrBadSnapshot)
+		}
+		if _, err := io.ReadFull(hr, buf[:size]); err != nil {
+			return snapshotEntry{}, fmt.Errorf("%w: %s", ErrBadSnapshot, err)
+		}
+		if _, err := f.Write(buf[:size]); err != nil {
+			return snapshotEntry{}, err
+		}
+	}
+	return entry, f.Close()
+}
+
+// hashingReader hashes every byte read through it
+type hashingReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	return n, err
+}
+
+func (hr *hashingReader) ReadByte() (byte, error) {
+	b, err := hr.r.ReadByte()
+	if err == nil {
+		hr.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+// walkKeyFiles is walkKeys which also passes the path of the value file
+func (m *Memoria) walkKeyFiles(fn func(key, path string) error) error {
+	var fnErr error
+	err := m.walkPaths(func(key, path string) bool {
+		fnErr = fn(key, path)
+		return fnErr == nil
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+// benchmarkPairs returns n values of size bytes which compress about as well as text
+func benchmarkPairs(n, size int) map[string][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	words := [][]byte{[]byte("memoria "), []byte("stores "), []byte("values "), []byte("by "), []byte("key ")}
+	pairs := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		var val bytes.Buffer
+		for val.Len() < size {
+			val.Write(words[rnd.Intn(len(words))])
+		}
+		pairs[fmt.Sprintf("key-%d", i)] = val.Bytes()[:size]
+	}
+	return pairs
+}
+
+// BenchmarkBulkWrite compares the throughput of BulkWrite with one and several workers.
+// Values are copied and compressed outside the store's mutex so more workers write more
+func BenchmarkBulkWrite(b *testing.B) {
+	pairs := benchmarkPairs(64, 64*1024)
+	for _, compression := range []memoria.Compression{nil, memoria.NewGzipCompression()} {
+		for _, workers := range []int{1, 4, 16} {
+			name := fmt.Sprintf("compressed=%v/workers=%d", compression != nil, workers)
+			b.Run(name, func(b *testing.B) {
+				m := memoria.New(memoria.Options{Basedir: b.TempDir(), Compression: compression})
+				b.SetBytes(int64(len(pairs) * 64 * 1024))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					for _, result := range m.BulkWrite(pairs, workers) {
+						if result.Error != nil {
+							b.Fatalf("BulkWrite() error = %v", result.Error)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkParallelReadWrite mixes cached reads with writes of other keys
+func BenchmarkParallelReadWrite(b *testing.B) {
+	m := memoria.New(memoria.Options{Basedir: b.TempDir(), MaxCacheSize: 1024 * 1024})
+	pairs := benchmarkPairs(16, 4096)
+	for key, val := range pairs {
+		if err := m.Write(key, val); err != nil {
+			b.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			key := fmt.Sprintf("key-%d", rnd.Intn(len(pairs)))
+			if rnd.Intn(10) == 0 {
+				if err := m.Write(key, pairs[key]); err != nil {
+					b.Fatalf("Write() error = %v", err)
+				}
+			} else if _, err := m.Read(key); err != nil {
+				b.Fatalf("Read() error = %v", err)
+			}
+		}
+	})
+}
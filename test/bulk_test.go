@@ -0,0 +1,125 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestBulkRead(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS(), MaxCacheSize: 1 << 20})
+
+	keys := []string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		if i%10 != 0 {
+			if err := m.WriteString(key, "value of "+key); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		}
+		keys = append(keys, key)
+	}
+	keys = append(keys, "", "key001") // an invalid key and a duplicate
+
+	for _, workers := range []int{-1, 0, 1, 8, 500} {
+		results := m.BulkRead(keys, workers)
+		if len(results) != len(keys) {
+			t.Fatalf("BulkRead(%d workers) returned %d results, want %d", workers, len(results), len(keys))
+		}
+		for i, result := range results {
+			if result.Key != keys[i] {
+				t.Fatalf("BulkRead(%d workers) result %d is for %q, want %q", workers, i, result.Key, keys[i])
+			}
+			switch {
+			case result.Key == "":
+				if result.Error == nil {
+					t.Fatalf("BulkRead() of an empty key succeeded")
+				}
+			case i < 100 && i%10 == 0:
+				if !errors.Is(result.Error, memoria.ErrKeyNotFound) {
+					t.Fatalf("BulkRead(%s) error = %v, want ErrKeyNotFound", result.Key, result.Error)
+				}
+			default:
+				if result.Error != nil || string(result.Value) != "value of "+result.Key {
+					t.Fatalf("BulkRead(%s) = %q, %v, want %q", result.Key, result.Value, result.Error, "value of "+result.Key)
+				}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range m.BulkReadCtx(ctx, keys, 4) {
+		if !errors.Is(result.Error, memoria.ErrNotAttempted) {
+			t.Fatalf("BulkReadCtx(%s) with a cancelled context error = %v, want ErrNotAttempted", result.Key, result.Error)
+		}
+	}
+}
+
+func TestBulkErase(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS(), MaxCacheSize: 1 << 20})
+
+	pairs := map[string][]byte{}
+	for i := 0; i < 50; i++ {
+		pairs[fmt.Sprintf("key%02d", i)] = []byte("value")
+	}
+	for _, result := range m.BulkWrite(pairs, 0) {
+		if result.Error != nil {
+			t.Fatalf("BulkWrite(%s) error = %v", result.Key, result.Error)
+		}
+	}
+	m.BulkRead([]string{"key00", "key01"}, 0) // cached
+
+	keys := []string{"key00", "missing", "key01"}
+	for i := 2; i < 50; i++ {
+		keys = append(keys, fmt.Sprintf("key%02d", i))
+	}
+	results := m.BulkErase(keys, -1)
+	for i, result := range results {
+		if result.Key != keys[i] {
+			t.Fatalf("BulkErase() result %d is for %q, want %q", i, result.Key, keys[i])
+		}
+		if result.Key == "missing" {
+			if !errors.Is(result.Error, memoria.ErrKeyNotFound) {
+				t.Fatalf("BulkErase(missing) error = %v, want ErrKeyNotFound", result.Error)
+			}
+		} else if result.Error != nil {
+			t.Fatalf("BulkErase(%s) error = %v", result.Key, result.Error)
+		}
+	}
+	if got := collectKeys(m); len(got) != 0 {
+		t.Fatalf("Keys() after BulkErase = %v, want none", got)
+	}
+	if _, err := m.Read("key00"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Fatalf("Read() of a cached key after BulkErase error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestBulkDefaultWorkers(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS()})
+
+	// numWorkers <= 0 used to leave BulkWrite waiting forever
+	done := make(chan []memoria.WriteResult)
+	go func() { done <- m.BulkWrite(map[string][]byte{"a": []byte("1"), "b": []byte("2")}, 0) }()
+	select {
+	case results := <-done:
+		if len(results) != 2 || results[0].Key != "a" || results[1].Key != "b" {
+			t.Fatalf("BulkWrite() = %v, want the results of a and b in order", results)
+		}
+		for _, result := range results {
+			if result.Error != nil {
+				t.Fatalf("BulkWrite(%s) error = %v", result.Key, result.Error)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("BulkWrite() with no workers did not return")
+	}
+
+	if results := m.BulkRead(nil, 0); len(results) != 0 {
+		t.Fatalf("BulkRead(nil) = %v, want no results", results)
+	}
+}
@@ -1 +1,138 @@
 package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+// newCacheStore returns a store with room for three 10 byte values using the given policy
+func newCacheStore(t *testing.T, policy memoria.CachePolicy) *memoria.Memoria {
+	t.Helper()
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	return memoria.New(memoria.Options{
+		Basedir:      tempDir,
+		MaxCacheSize: 30,
+		CachePolicy:  policy,
+	})
+}
+
+// readKeys reads every key once, failing the test on errors
+func readKeys(t *testing.T, m *memoria.Memoria, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if _, err := m.Read(key); err != nil {
+			t.Fatalf("Read(%s) error = %v", key, err)
+		}
+	}
+}
+
+// assertCached removes the key files from disk so only cached keys stay readable and
+// checks that exactly the wanted keys are still in the cache
+func assertCached(t *testing.T, m *memoria.Memoria, cached []string, ejected []string) {
+	t.Helper()
+	for _, key := range append(append([]string{}, cached...), ejected...) {
+		os.Remove(filepath.Join(m.Basedir, key))
+	}
+	for _, key := range cached {
+		if _, err := m.Read(key); err != nil {
+			t.Errorf("key %s was ejected, want cached", key)
+		}
+	}
+	for _, key := range ejected {
+		if _, err := m.Read(key); err == nil {
+			t.Errorf("key %s is cached, want ejected", key)
+		}
+	}
+}
+
+func writeKeys(t *testing.T, m *memoria.Memoria, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := m.WriteString(key, "0123456789"); err != nil {
+			t.Fatalf("Write(%s) error = %v", key, err)
+		}
+	}
+}
+
+func TestLRUCachePolicy(t *testing.T) {
+	m := newCacheStore(t, memoria.NewLRUCachePolicy())
+	writeKeys(t, m, "a", "b", "c", "d")
+
+	readKeys(t, m, "a", "b", "c")
+	// hit a so b becomes the least recently used key
+	readKeys(t, m, "a")
+	readKeys(t, m, "d")
+
+	assertCached(t, m, []string{"a", "c", "d"}, []string{"b"})
+}
+
+func TestLRUCachePolicyOverwrite(t *testing.T) {
+	m := newCacheStore(t, memoria.NewLRUCachePolicy())
+	writeKeys(t, m, "a", "b", "c", "d")
+
+	readKeys(t, m, "a", "b", "c")
+	// overwriting a removes it from the cache, reading it again makes it the newest
+	writeKeys(t, m, "a")
+	readKeys(t, m, "a", "d")
+
+	assertCached(t, m, []string{"a", "c", "d"}, []string{"b"})
+}
+
+func TestCacheValueLargerThanCache(t *testing.T) {
+	m := newCacheStore(t, memoria.NewLRUCachePolicy())
+	if err := m.WriteString("big", "a value which does not fit in the cache"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got, err := m.ReadString("big")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got != "a value which does not fit in the cache" {
+		t.Errorf("Read() got = %q", got)
+	}
+}
+
+func TestLFUCachePolicy(t *testing.T) {
+	m := newCacheStore(t, memoria.NewLFUCachePolicy())
+	writeKeys(t, m, "a", "b", "c", "d")
+
+	readKeys(t, m, "a", "b", "c")
+	// a is hit twice and b once, c is never hit
+	readKeys(t, m, "a", "a", "b")
+	readKeys(t, m, "d") // ejects c
+	readKeys(t, m, "c") // ejects d, the only key hit less often than a and b
+
+	assertCached(t, m, []string{"a", "b", "c"}, []string{"d"})
+}
+
+func TestARCCachePolicy(t *testing.T) {
+	m := newCacheStore(t, memoria.NewARCCachePolicy())
+	writeKeys(t, m, "a", "b", "c", "d", "e")
+
+	// a and b are hit so they move to the frequency list
+	readKeys(t, m, "a", "b", "a", "b")
+	// a scan of keys read once only churns the recency list, LRU would have ejected a and b
+	readKeys(t, m, "c", "d", "e")
+
+	assertCached(t, m, []string{"a", "b", "e"}, []string{"c", "d"})
+}
+
+func TestARCCachePolicyGhostHit(t *testing.T) {
+	m := newCacheStore(t, memoria.NewARCCachePolicy())
+	writeKeys(t, m, "a", "b", "c", "d", "e")
+
+	readKeys(t, m, "a", "b", "a", "b", "c", "d", "e")
+	// c was ejected from the recency list recently, reading it again grows the
+	// recency target and ejects e rather than a frequently hit key
+	readKeys(t, m, "c")
+
+	assertCached(t, m, []string{"a", "b", "c"}, []string{"d", "e"})
+}
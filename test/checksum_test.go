@@ -0,0 +1,129 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func newChecksumStore(t *testing.T, dir string, compression memoria.Compression) *memoria.Memoria {
+	t.Helper()
+	return memoria.New(memoria.Options{Basedir: dir, Checksum: true, Compression: compression, MaxCacheSize: 1024})
+}
+
+// damage applies fn to the contents of the value file of key
+func damage(t *testing.T, dir, key string, fn func([]byte) []byte) {
+	t.Helper()
+	path := filepath.Join(dir, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read value file: %v", err)
+	}
+	if err := os.WriteFile(path, fn(data), 0644); err != nil {
+		t.Fatalf("cannot write value file: %v", err)
+	}
+}
+
+func TestChecksumRoundTrip(t *testing.T) {
+	for _, compression := range []memoria.Compression{nil, memoria.NewGzipCompression()} {
+		m := newChecksumStore(t, t.TempDir(), compression)
+		val := bytes.Repeat([]byte("checksummed "), 100)
+		if err := m.Write("key", val); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if err := m.WriteWithAppend("key", []byte("tail")); err != nil {
+			t.Fatalf("WriteWithAppend() error = %v", err)
+		}
+		want := append(val, "tail"...)
+
+		if got, err := m.Read("key"); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Read() = %d bytes, %v", len(got), err)
+		}
+		if err := m.Verify("key"); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+		if corrupt, err := m.Scrub(); err != nil || len(corrupt) != 0 {
+			t.Errorf("Scrub() = %v, %v, want nothing corrupt", corrupt, err)
+		}
+	}
+}
+
+func TestChecksumDetectsCorruption(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression memoria.Compression
+		damage      func([]byte) []byte
+	}{
+		{"bit flip", nil, func(b []byte) []byte { b[len(b)-1] ^= 1; return b }},
+		{"truncated", nil, func(b []byte) []byte { return b[:len(b)-3] }},
+		{"compressed bit flip", memoria.NewGzipCompression(), func(b []byte) []byte { b[len(b)-10] ^= 0xff; return b }}, // inside the deflate stream
+		{"compressed truncated", memoria.NewGzipCompression(), func(b []byte) []byte { return b[:len(b)-3] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := newChecksumStore(t, dir, tt.compression)
+			for _, key := range []string{"good", "bad"} {
+				if err := m.Write(key, bytes.Repeat([]byte(key), 200)); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			damage(t, dir, "bad", tt.damage)
+
+			if _, err := m.Read("bad"); !errors.Is(err, memoria.ErrCorrupt) {
+				t.Errorf("Read() error = %v, want ErrCorrupt", err)
+			}
+			// the corrupt value was not cached by the failed read
+			if _, err := m.Read("bad"); !errors.Is(err, memoria.ErrCorrupt) {
+				t.Errorf("second Read() error = %v, want ErrCorrupt", err)
+			}
+			if err := m.Verify("bad"); !errors.Is(err, memoria.ErrCorrupt) {
+				t.Errorf("Verify() error = %v, want ErrCorrupt", err)
+			}
+			if err := m.Verify("good"); err != nil {
+				t.Errorf("Verify() of an intact value error = %v", err)
+			}
+			if corrupt, err := m.Scrub(); err != nil || !reflect.DeepEqual(corrupt, []string{"bad"}) {
+				t.Errorf("Scrub() = %v, %v, want [bad]", corrupt, err)
+			}
+		})
+	}
+}
+
+func TestChecksumCompatibility(t *testing.T) {
+	dir := t.TempDir()
+	plain := memoria.New(memoria.Options{Basedir: dir})
+	if err := plain.Write("old", []byte("written without checksum")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	m := newChecksumStore(t, dir, nil)
+	if val, err := m.Read("old"); err != nil || string(val) != "written without checksum" {
+		t.Errorf("Read() = %q, %v", val, err)
+	}
+	if err := m.Verify("old"); err != nil {
+		t.Errorf("Verify() of a value without checksum error = %v", err)
+	}
+
+	if err := m.Verify("missing"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("Verify() error = %v, want ErrKeyNotFound", err)
+	}
+
+	// stores without checksums read values exactly as they are stored, so a value
+	// which looks like a checksum header is not mistaken for one
+	value := "\x00MCS\x01\x02\x03\x04y"
+	if err := plain.Write("header", []byte(value)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if val, err := plain.Read("header"); err != nil || string(val) != value {
+		t.Errorf("Read() = %q, %v, want %q", val, err, value)
+	}
+	if corrupt, err := plain.Scrub(); err != nil || len(corrupt) != 0 {
+		t.Errorf("Scrub() = %v, %v, want nothing corrupt", corrupt, err)
+	}
+}
@@ -0,0 +1,172 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+// removalPolicy is an LRU policy which records the keys removed from the cache
+type removalPolicy struct {
+	memoria.CachePolicy
+	mu      sync.Mutex
+	removed []string
+}
+
+func (p *removalPolicy) Hit(m *memoria.Memoria, key string) {
+	p.CachePolicy.(memoria.CacheObserver).Hit(m, key)
+}
+
+func (p *removalPolicy) Remove(m *memoria.Memoria, key string) {
+	p.CachePolicy.(memoria.CacheObserver).Remove(m, key)
+	p.mu.Lock()
+	p.removed = append(p.removed, key)
+	p.mu.Unlock()
+}
+
+func TestBypassReadEvictsBeforeReturning(t *testing.T) {
+	policy := &removalPolicy{CachePolicy: memoria.NewLRUCachePolicy()}
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024, CachePolicy: policy})
+	if err := m.Write("key", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := m.Read("key"); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	r, err := m.ReadStream("key", true)
+	if err != nil {
+		t.Fatalf("ReadStream() error = %v", err)
+	}
+	defer r.Close()
+
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	if len(policy.removed) != 1 || policy.removed[0] != "key" {
+		t.Errorf("removed %v by the time ReadStream returned, want [key]", policy.removed)
+	}
+}
+
+func TestReadBeforeWriteIsNotCached(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(m *memoria.Memoria) error
+		want   string
+	}{
+		{"write", func(m *memoria.Memoria) error { return m.Write("key", []byte("new")) }, "new"},
+		{"append", func(m *memoria.Memoria) error { return m.WriteWithAppend("key", []byte("+")) }, "old+"},
+		{"erase", func(m *memoria.Memoria) error { return m.Erase("key") }, ""},
+		{"erase all", func(m *memoria.Memoria) error { return m.EraseAll() }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024})
+			if err := m.Write("key", []byte("old")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			// the read opens the old value before the key is modified
+			r, err := m.ReadStream("key", false)
+			if err != nil {
+				t.Fatalf("ReadStream() error = %v", err)
+			}
+			if err := tt.modify(m); err != nil {
+				t.Fatalf("modifying the key failed: %v", err)
+			}
+			if val, err := io.ReadAll(r); err != nil || string(val) != "old" {
+				t.Fatalf("ReadAll() = %q, %v, want the old value", val, err)
+			}
+
+			val, err := m.Read("key")
+			if tt.want == "" {
+				if !errors.Is(err, memoria.ErrKeyNotFound) {
+					t.Errorf("Read() = %q, %v, want ErrKeyNotFound", val, err)
+				}
+			} else if err != nil || string(val) != tt.want {
+				t.Errorf("Read() = %q, %v, want %q", val, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadStreamCloseBeforeEOF(t *testing.T) {
+	for _, cacheSize := range []uint64{0, 1024} {
+		m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: cacheSize})
+		if err := m.Write("key", []byte("value")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		r, err := m.ReadStream("key", false)
+		if err != nil {
+			t.Fatalf("ReadStream() error = %v", err)
+		}
+		r.Read(make([]byte, 2))
+		if err := r.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("second Close() error = %v", err)
+		}
+
+		// a partly read value is never cached
+		if err := m.Write("key", []byte("other")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if val, err := m.Read("key"); err != nil || string(val) != "other" {
+			t.Errorf("Read() = %q, %v", val, err)
+		}
+	}
+}
+
+// TestConcurrentCacheCoherency is meant to be run with the race detector
+func TestConcurrentCacheCoherency(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 64})
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		if err := m.Write(key, []byte("0")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 1; i <= rounds; i++ {
+				if err := m.Write(key, []byte(fmt.Sprint(i))); err != nil {
+					t.Errorf("Write() error = %v", err)
+					return
+				}
+			}
+		}(key)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(bypass bool) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				rc, err := m.ReadStream(keys[i%len(keys)], bypass)
+				if err != nil {
+					t.Errorf("ReadStream() error = %v", err)
+					return
+				}
+				io.ReadAll(rc)
+				rc.Close()
+			}
+		}(r%2 == 0)
+	}
+	wg.Wait()
+
+	// whatever was cached along the way the final values are the last ones written
+	for _, key := range keys {
+		if val, err := m.Read(key); err != nil || string(val) != fmt.Sprint(rounds) {
+			t.Errorf("Read(%q) = %q, %v, want %d", key, val, err, rounds)
+		}
+	}
+}
@@ -1 +1,121 @@
 package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestCompressionWriteRead(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name        string
+		compression memoria.Compression
+	}{
+		{name: "gzip", compression: memoria.NewGzipCompression()},
+		{name: "zlib", compression: memoria.NewZlibCompression()},
+		{name: "flate", compression: memoria.NewFlateCompression()},
+	}
+
+	value := []byte(strings.Repeat("made with love ", 100))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memoria.New(memoria.Options{
+				Basedir:      filepath.Join(tempDir, tt.name),
+				MaxCacheSize: 4096,
+				Compression:  tt.compression,
+			})
+
+			if err := m.Write("key", value); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			onDisk, err := os.ReadFile(filepath.Join(m.Basedir, "key"))
+			if err != nil {
+				t.Fatalf("Failed to read key file: %v", err)
+			}
+			if len(onDisk) >= len(value) {
+				t.Errorf("value was not compressed: %d bytes on disk for %d bytes", len(onDisk), len(value))
+			}
+
+			// the first read comes from disk, the second from the cache
+			for i := 0; i < 2; i++ {
+				got, err := m.Read("key")
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				if !bytes.Equal(got, value) {
+					t.Errorf("Read() got %d bytes, want %d bytes", len(got), len(value))
+				}
+			}
+
+			if err := m.WriteWithAppend("key", []byte("!")); err != nil {
+				t.Fatalf("WriteWithAppend() error = %v", err)
+			}
+			got, err := m.Read("key")
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !bytes.Equal(got, append(value, '!')) {
+				t.Errorf("Read() after append got %d bytes, want %d bytes", len(got), len(value)+1)
+			}
+		})
+	}
+}
+
+func TestCompressionReadsUncompressedValues(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	plain := memoria.New(memoria.Options{Basedir: tempDir, MaxCacheSize: 1024})
+	if err := plain.WriteString("old", "written without compression"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	m := memoria.New(memoria.Options{
+		Basedir:      tempDir,
+		MaxCacheSize: 1024,
+		Compression:  memoria.NewGzipCompression(),
+	})
+
+	got, err := m.ReadString("old")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got != "written without compression" {
+		t.Errorf("Read() got = %q, want %q", got, "written without compression")
+	}
+
+	// a store without compression reads values exactly as they are stored
+	if err := m.WriteString("new", "compressed"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got, err := plain.ReadString("new"); err != nil || got == "compressed" {
+		t.Errorf("Read() of compressed value without compression = %q, %v, want the stored bytes", got, err)
+	}
+}
+
+func TestPlainValueStartingWithCompressionMagic(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS()})
+
+	value := "\x00MZCx"
+	if err := m.WriteString("key", value); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got, err := readBypassingCache(m, "key"); err != nil || string(got) != value {
+		t.Errorf("Read() = %q, %v, want %q", got, err, value)
+	}
+}
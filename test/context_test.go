@@ -0,0 +1,195 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+// cancellingReader cancels its context once n bytes were read from it
+type cancellingReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (cr *cancellingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if cr.n -= n; cr.n <= 0 {
+		cr.cancel()
+	}
+	return n, err
+}
+
+func TestWriteStreamCtx(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS(), MaxCacheSize: 1 << 20})
+	if err := m.WriteString("key", "old"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// the copy stops at the next chunk once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	src := bytes.NewReader(bytes.Repeat([]byte("x"), 1<<20))
+	r := &cancellingReader{r: src, n: 4096, cancel: cancel}
+	if err := m.WriteStreamCtx(ctx, "key", r, false, false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("WriteStreamCtx() error = %v, want context.Canceled", err)
+	}
+	if src.Len() == 0 {
+		t.Fatalf("WriteStreamCtx() read the whole value after the context was cancelled")
+	}
+	checkValue(t, m, "key", "old")
+	checkClean(t, m)
+
+	if err := m.WriteCtx(ctx, "other", []byte("value")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("WriteCtx() error = %v, want context.Canceled", err)
+	}
+	if m.Has("other") {
+		t.Fatalf("Has() = true after a cancelled WriteCtx")
+	}
+
+	if err := m.WriteCtx(context.Background(), "other", []byte("value")); err != nil {
+		t.Fatalf("WriteCtx() error = %v", err)
+	}
+	checkValue(t, m, "other", "value")
+}
+
+func TestReadCtx(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS()})
+	if err := m.WriteString("key", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if got, err := m.ReadCtx(context.Background(), "key"); err != nil || string(got) != "value" {
+		t.Fatalf("ReadCtx() = %q, %v, want %q", got, err, "value")
+	}
+	if _, err := m.ReadCtx(context.Background(), "missing"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Fatalf("ReadCtx(missing) error = %v, want ErrKeyNotFound", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.ReadCtx(ctx, "key"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadCtx() error = %v, want context.Canceled", err)
+	}
+}
+
+// cancellingFS cancels a context once n values were renamed into place
+type cancellingFS struct {
+	memoria.FS
+	n      atomic.Int32
+	cancel context.CancelFunc
+}
+
+func (c *cancellingFS) Rename(oldpath, newpath string) error {
+	err := c.FS.Rename(oldpath, newpath)
+	if c.n.Add(-1) == 0 {
+		c.cancel()
+	}
+	return err
+}
+
+func TestBulkWriteCtx(t *testing.T) {
+	pairs := make(map[string][]byte)
+	for i := 0; i < 50; i++ {
+		pairs[fmt.Sprintf("key%d", i)] = []byte(strings.Repeat("v", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fsys := &cancellingFS{FS: memoria.NewMemFS(), cancel: cancel}
+	fsys.n.Store(3)
+	m, err := memoria.Open(memoria.Options{Basedir: "store"}, memoria.WithFS(fsys))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+
+	results := m.BulkWriteCtx(ctx, pairs, 1)
+	if len(results) != len(pairs) {
+		t.Fatalf("BulkWriteCtx() returned %d results, want %d", len(results), len(pairs))
+	}
+	written := 0
+	for _, result := range results {
+		switch {
+		case result.Error == nil:
+			written++
+			if got, err := m.Read(result.Key); err != nil || !bytes.Equal(got, pairs[result.Key]) {
+				t.Fatalf("Read(%s) = %q, %v, want %q", result.Key, got, err, pairs[result.Key])
+			}
+		case errors.Is(result.Error, memoria.ErrNotAttempted):
+			if !errors.Is(result.Error, context.Canceled) {
+				t.Fatalf("BulkWriteCtx(%s) error = %v, want context.Canceled", result.Key, result.Error)
+			}
+			if m.Has(result.Key) {
+				t.Fatalf("Has(%s) = true for a key which was not attempted", result.Key)
+			}
+		default:
+			t.Fatalf("BulkWriteCtx(%s) error = %v", result.Key, result.Error)
+		}
+	}
+	// the worker takes no pair once the context is cancelled by the third write
+	if written != 3 {
+		t.Fatalf("BulkWriteCtx() wrote %d keys, want 3", written)
+	}
+
+	results = m.BulkWriteCtx(ctx, pairs, 4)
+	for _, result := range results {
+		if !errors.Is(result.Error, memoria.ErrNotAttempted) {
+			t.Fatalf("BulkWriteCtx(%s) with a cancelled context error = %v, want ErrNotAttempted", result.Key, result.Error)
+		}
+	}
+	if len(results) != len(pairs) {
+		t.Fatalf("BulkWriteCtx() returned %d results, want %d", len(results), len(pairs))
+	}
+}
+
+func TestBulkWriteCtxWithWAL(t *testing.T) {
+	pairs := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		pairs[fmt.Sprintf("key%d", i)] = []byte(strings.Repeat("v", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mem := memoria.NewMemFS()
+	fsys := &cancellingFS{FS: mem, cancel: cancel}
+	fsys.n.Store(3)
+	m, err := memoria.Open(memoria.Options{Basedir: "store"}, memoria.WithFS(fsys), memoria.WithWAL(memoria.WALSyncAlways))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	results := m.BulkWriteCtx(ctx, pairs, 1)
+	m.Close()
+
+	// the stopped batch is aborted in the log, so Open writes none of the keys which
+	// were reported as not attempted
+	m, err = memoria.Open(memoria.Options{Basedir: "store"}, memoria.WithFS(mem), memoria.WithWAL(memoria.WALSyncAlways))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+	written := 0
+	for _, result := range results {
+		switch {
+		case result.Error == nil:
+			written++
+			if got, err := m.Read(result.Key); err != nil || !bytes.Equal(got, pairs[result.Key]) {
+				t.Errorf("Read(%s) = %q, %v, want %q", result.Key, got, err, pairs[result.Key])
+			}
+		case errors.Is(result.Error, memoria.ErrNotAttempted):
+			if m.Has(result.Key) {
+				t.Errorf("Has(%s) = true after reopening, the key was not attempted", result.Key)
+			}
+		default:
+			t.Fatalf("BulkWriteCtx(%s) error = %v", result.Key, result.Error)
+		}
+	}
+	if written != 3 {
+		t.Fatalf("BulkWriteCtx() wrote %d keys, want 3", written)
+	}
+}
@@ -0,0 +1,287 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+const tempFiles = ".memoria-tmp-*"
+
+func newFaultStore(t *testing.T, fsys *faultFS, opts ...memoria.Option) *memoria.Memoria {
+	t.Helper()
+	m, err := memoria.Open(memoria.Options{Basedir: "store", MaxCacheSize: 1024},
+		append([]memoria.Option{memoria.WithFS(fsys)}, opts...)...)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// checkClean fails the test if the store has temp files left or any other problem
+func checkClean(t *testing.T, m *memoria.Memoria) {
+	t.Helper()
+	report, err := m.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("Check() problems = %v, want none", report.Problems)
+	}
+}
+
+// checkValue reads the key from the cache and from disk
+func checkValue(t *testing.T, m *memoria.Memoria, key, want string) {
+	t.Helper()
+	if got, err := m.ReadString(key); err != nil || got != want {
+		t.Fatalf("Read(%s) = %q, %v, want %q", key, got, err, want)
+	}
+	if got, err := readBypassingCache(m, key); err != nil || string(got) != want {
+		t.Fatalf("Read(%s) bypassing the cache = %q, %v, want %q", key, got, err, want)
+	}
+}
+
+func TestWriteFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault fault
+		sync  bool
+		want  error
+	}{
+		{"no space", fault{op: "write", pattern: tempFiles, err: syscall.ENOSPC}, false, syscall.ENOSPC},
+		{"short write", fault{op: "write", pattern: tempFiles, err: syscall.ENOSPC, short: true}, false, syscall.ENOSPC},
+		{"sync", fault{op: "sync", pattern: tempFiles, err: syscall.EIO}, true, syscall.EIO},
+		{"close", fault{op: "close", pattern: tempFiles, err: syscall.EIO}, false, syscall.EIO},
+		{"rename", fault{op: "rename", pattern: "key", err: syscall.EIO}, false, syscall.EIO},
+		{"create", fault{op: "open", pattern: tempFiles, err: syscall.ENOSPC}, false, nil},
+	}
+
+	for _, compressed := range []bool{false, true} {
+		for _, tt := range tests {
+			name, opts := tt.name, []memoria.Option{}
+			if compressed {
+				name += " compressed"
+				opts = append(opts, memoria.WithCompression(memoria.NewGzipCompression()), memoria.WithChecksums())
+			}
+			t.Run(name, func(t *testing.T) {
+				fsys := newFaultFS()
+				m := newFaultStore(t, fsys, opts...)
+				if err := m.WriteString("key", "old"); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+				checkValue(t, m, "key", "old") // cached
+
+				fsys.fail(tt.fault)
+				err := m.WriteStream("key", strings.NewReader(strings.Repeat("new", 1000)), false, tt.sync)
+				if err == nil {
+					t.Fatalf("WriteStream() succeeded")
+				}
+				if tt.want != nil && !errors.Is(err, tt.want) {
+					t.Fatalf("WriteStream() error = %v, want %v", err, tt.want)
+				}
+				fsys.heal()
+
+				// the failed write leaves the old value, in the cache and on disk, and
+				// no temp file behind
+				checkValue(t, m, "key", "old")
+				checkClean(t, m)
+
+				if err := m.WriteString("key", "new"); err != nil {
+					t.Fatalf("Write() after the fault error = %v", err)
+				}
+				checkValue(t, m, "key", "new")
+			})
+		}
+	}
+}
+
+func TestCleanUpFaults(t *testing.T) {
+	fsys := newFaultFS()
+	m := newFaultStore(t, fsys)
+	if err := m.WriteString("key", "old"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// the temp file is removed even though closing it fails as well, and both errors
+	// are returned
+	fsys.fail(fault{op: "sync", pattern: tempFiles, err: syscall.EIO})
+	fsys.fail(fault{op: "close", pattern: tempFiles, err: syscall.EBADF})
+	err := m.WriteStream("key", strings.NewReader("new"), false, true)
+	if !errors.Is(err, syscall.EIO) || !errors.Is(err, syscall.EBADF) {
+		t.Fatalf("WriteStream() error = %v, want EIO and EBADF", err)
+	}
+	fsys.heal()
+	checkClean(t, m)
+
+	// a temp file which cannot be removed is reported with the error of the write
+	fsys.fail(fault{op: "write", pattern: tempFiles, err: syscall.ENOSPC})
+	fsys.fail(fault{op: "remove", pattern: tempFiles, err: syscall.EACCES})
+	err = m.WriteStream("key", strings.NewReader("new"), false, false)
+	if !errors.Is(err, syscall.ENOSPC) || !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("WriteStream() error = %v, want ENOSPC and EACCES", err)
+	}
+	fsys.heal()
+	checkValue(t, m, "key", "old")
+
+	report, err := m.Repair(context.Background())
+	if err != nil || report.Count(memoria.ProblemTempFile) != 1 || report.Unrepaired() != 0 {
+		t.Fatalf("Repair() = %v, %v, want the temp file removed", report, err)
+	}
+}
+
+func TestWriterFaults(t *testing.T) {
+	fsys := newFaultFS()
+	m := newFaultStore(t, fsys)
+	if err := m.WriteString("key", "old"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	w, err := m.Create("key")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	fsys.fail(fault{op: "write", pattern: tempFiles, err: syscall.ENOSPC, short: true, times: 1})
+	if _, err := w.Write([]byte("new value")); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Write() error = %v, want ENOSPC", err)
+	}
+	// the write failed so the value is discarded even though the fault is gone
+	if _, err := w.Write([]byte("more")); err == nil {
+		t.Fatalf("Write() after a failed write succeeded")
+	}
+	if err := w.Close(); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Close() error = %v, want ENOSPC", err)
+	}
+	checkValue(t, m, "key", "old")
+	checkClean(t, m)
+}
+
+func TestRenameFaultKeepsExpiry(t *testing.T) {
+	fsys := newFaultFS()
+	m := newFaultStore(t, fsys)
+
+	if err := m.WriteString("key", "forever"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	fsys.fail(fault{op: "rename", pattern: "key", err: syscall.EIO})
+	if err := m.WriteWithTTL("key", []byte("short"), time.Millisecond); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("WriteWithTTL() error = %v, want EIO", err)
+	}
+	fsys.heal()
+
+	// the old value keeps living without an expiry
+	time.Sleep(5 * time.Millisecond)
+	if ttl, err := m.TTL("key"); err != nil || ttl != memoria.NoExpiry {
+		t.Fatalf("TTL() = %v, %v, want NoExpiry", ttl, err)
+	}
+	checkValue(t, m, "key", "forever")
+}
+
+func TestRemoveExpiryFaultPublishesValue(t *testing.T) {
+	fsys := newFaultFS()
+	m := newFaultStore(t, fsys)
+
+	if err := m.WriteWithTTL("key", []byte("old"), time.Hour); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	checkValue(t, m, "key", "old") // cached
+	fsys.fail(fault{op: "remove", pattern: ".memoria-ttl-*", err: syscall.EIO})
+	if err := m.WriteString("key", "new"); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Write() error = %v, want EIO", err)
+	}
+	fsys.heal()
+
+	// the new value is in place, so the cache no longer serves the old one, and the
+	// expiry which could not be removed still applies
+	checkValue(t, m, "key", "new")
+	if ttl, err := m.TTL("key"); err != nil || ttl <= 0 {
+		t.Fatalf("TTL() = %v, %v, want the old expiry", ttl, err)
+	}
+}
+
+func TestSnapshotDirFault(t *testing.T) {
+	fsys := newFaultFS()
+	m := newFaultStore(t, fsys)
+	if err := m.WriteString("key", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// without a directory to link the values into they are read where they are
+	fsys.fail(fault{op: "mkdir", pattern: ".memoria-snapshot-*", err: syscall.EACCES})
+	var snapshot bytes.Buffer
+	if err := m.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	restored := newFaultStore(t, newFaultFS())
+	if err := restored.Restore(&snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	checkValue(t, restored, "key", "value")
+}
+
+func TestPowerLoss(t *testing.T) {
+	for _, opts := range [][]memoria.Option{
+		nil,
+		{memoria.WithCompression(memoria.NewZlibCompression()), memoria.WithChecksums()},
+		{memoria.WithContentAddressing(), memoria.WithPathTransform(memoria.ShardedTransform(1, 2))},
+		{memoria.WithPathTransform(memoria.HashedTransform(2, 1))},
+	} {
+		fsys := newFaultFS()
+		m := newFaultStore(t, fsys, opts...)
+
+		if err := m.WriteStream("synced", bytes.NewReader([]byte("durable")), false, true); err != nil {
+			t.Fatalf("WriteStream() error = %v", err)
+		}
+		if err := m.WriteStream("replaced", bytes.NewReader([]byte("durable")), false, true); err != nil {
+			t.Fatalf("WriteStream() error = %v", err)
+		}
+		if err := m.WriteString("unsynced", "lost"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if err := m.WriteString("replaced", "lost"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		checkValue(t, m, "replaced", "lost")
+		m.Close()
+
+		fsys.crash()
+		m = newFaultStore(t, fsys, opts...)
+
+		// synced writes survive with their whole value, writes without sync may be lost
+		// but never leave a damaged value behind
+		checkValue(t, m, "synced", "durable")
+		checkValue(t, m, "replaced", "durable")
+		if m.Has("unsynced") {
+			t.Fatalf("Has(unsynced) = true after the power loss")
+		}
+		if corrupt, err := m.Scrub(); err != nil || len(corrupt) != 0 {
+			t.Fatalf("Scrub() = %v, %v, want no corrupt keys", corrupt, err)
+		}
+	}
+}
+
+func TestSyncDirFault(t *testing.T) {
+	fsys := newFaultFS()
+	m := newFaultStore(t, fsys)
+	if err := m.WriteString("key", "old"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	checkValue(t, m, "key", "old")
+
+	// the value is renamed into place before the directory sync fails, so it is the
+	// value read afterwards even though it may not survive a power loss
+	fsys.fail(fault{op: "sync", pattern: "store", err: syscall.EIO})
+	if err := m.WriteStream("key", strings.NewReader("new"), false, true); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("WriteStream() error = %v, want EIO", err)
+	}
+	fsys.heal()
+	checkValue(t, m, "key", "new")
+	checkClean(t, m)
+}
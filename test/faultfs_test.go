@@ -0,0 +1,347 @@
+package test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+// fault makes an operation of a faultFS fail
+type fault struct {
+	op      string // "open", "rename", "remove", "mkdir", "write", "sync" or "close"
+	pattern string // matched against the base name of the file, the destination of renames
+	err     error
+	short   bool // writes half of the data before failing
+	times   int  // how often the fault fires, forever when 0
+}
+
+// inode is a file of a faultFS
+type inode struct {
+	durable []byte // the data at the last sync of the file, lost on crash otherwise
+}
+
+// faultFS is an in-memory FS which fails the operations set up with fail and simulates a
+// power loss with crash. Only data synced to a file, in a directory whose entries were
+// synced after the file was created or renamed there, survives a crash. Directories
+// themselves always survive
+type faultFS struct {
+	mu     sync.Mutex
+	fs     memoria.FS
+	faults []*fault
+	inodes map[string]*inode            // the file at every path
+	synced map[string]map[string]*inode // the entries of every directory at its last sync
+}
+
+func newFaultFS() *faultFS {
+	return &faultFS{
+		fs:     memoria.NewMemFS(),
+		inodes: make(map[string]*inode),
+		synced: make(map[string]map[string]*inode),
+	}
+}
+
+// fail adds the fault, faults added first are matched first
+func (f *faultFS) fail(flt fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = append(f.faults, &flt)
+}
+
+// heal removes every fault
+func (f *faultFS) heal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = nil
+}
+
+// fault returns the fault of op on the file at path, if any
+func (f *faultFS) fault(op, path string) *fault {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, flt := range f.faults {
+		if flt.op != op {
+			continue
+		}
+		if ok, _ := filepath.Match(flt.pattern, filepath.Base(path)); !ok {
+			continue
+		}
+		if flt.times > 0 {
+			if flt.times--; flt.times == 0 {
+				f.faults = append(f.faults[:i:i], f.faults[i+1:]...)
+			}
+		}
+		return flt
+	}
+	return nil
+}
+
+// crash drops everything which was not synced, as a power loss would
+func (f *faultFS) crash() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fs := memoria.NewMemFS()
+	inodes := make(map[string]*inode)
+	synced := make(map[string]map[string]*inode)
+
+	// every directory survives
+	var walk func(dir string)
+	walk = func(dir string) {
+		entries, _ := f.fs.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				fs.MkdirAll(filepath.Join(dir, entry.Name()), 0777)
+				walk(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	walk(".")
+
+	// and so do the entries of the directories at their last sync, with the data of
+	// the files at their last sync
+	for dir, entries := range f.synced {
+		synced[dir] = make(map[string]*inode)
+		for name, ino := range entries {
+			path := filepath.Join(dir, name)
+			file, err := fs.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+			if err != nil {
+				continue
+			}
+			file.Write(ino.durable)
+			file.Close()
+			survivor := &inode{durable: ino.durable}
+			inodes[path] = survivor
+			synced[dir][name] = survivor
+		}
+	}
+
+	f.fs, f.inodes, f.synced = fs, inodes, synced
+}
+
+// move moves the inodes at old, and below it, to new. The caller must hold mu
+func (f *faultFS) move(old, new string, keep bool) {
+	for path, ino := range f.inodes {
+		rel, err := filepath.Rel(old, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if !keep {
+			delete(f.inodes, path)
+		}
+		if new != "" {
+			f.inodes[filepath.Join(new, rel)] = ino
+		}
+	}
+}
+
+// create records the file created at path, unless it already exists
+func (f *faultFS) create(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path = filepath.Clean(path)
+	if _, ok := f.inodes[path]; !ok {
+		f.inodes[path] = &inode{}
+	}
+}
+
+// inode returns the inode of the file at path, nil for directories
+func (f *faultFS) inode(path string) *inode {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inodes[filepath.Clean(path)]
+}
+
+// pathOf returns where the inode is now, files stay open when they are renamed. The
+// caller must hold mu
+func (f *faultFS) pathOf(ino *inode) (string, bool) {
+	for path, other := range f.inodes {
+		if other == ino {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func (f *faultFS) Open(name string) (memoria.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (f *faultFS) OpenFile(name string, flag int, perm os.FileMode) (memoria.File, error) {
+	if flt := f.fault("open", name); flt != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: flt.err}
+	}
+	file, err := f.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_CREATE != 0 {
+		f.create(name)
+	}
+	return &faultFile{File: file, fs: f, ino: f.inode(name)}, nil
+}
+
+func (f *faultFS) CreateTemp(dir, pattern string, perm os.FileMode) (memoria.File, error) {
+	if flt := f.fault("open", pattern); flt != nil {
+		return nil, &os.PathError{Op: "createtemp", Path: filepath.Join(dir, pattern), Err: flt.err}
+	}
+	file, err := f.fs.CreateTemp(dir, pattern, perm)
+	if err != nil {
+		return nil, err
+	}
+	f.create(file.Name())
+	return &faultFile{File: file, fs: f, ino: f.inode(file.Name())}, nil
+}
+
+func (f *faultFS) MkdirTemp(dir, pattern string) (string, error) {
+	if flt := f.fault("mkdir", pattern); flt != nil {
+		return "", &os.PathError{Op: "mkdirtemp", Path: filepath.Join(dir, pattern), Err: flt.err}
+	}
+	return f.fs.MkdirTemp(dir, pattern)
+}
+
+func (f *faultFS) MkdirAll(path string, perm os.FileMode) error {
+	if flt := f.fault("mkdir", path); flt != nil {
+		return &os.PathError{Op: "mkdir", Path: path, Err: flt.err}
+	}
+	return f.fs.MkdirAll(path, perm)
+}
+
+func (f *faultFS) Remove(name string) error {
+	if flt := f.fault("remove", name); flt != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: flt.err}
+	}
+	if err := f.fs.Remove(name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.move(filepath.Clean(name), "", false)
+	return nil
+}
+
+func (f *faultFS) RemoveAll(path string) error {
+	if flt := f.fault("remove", path); flt != nil {
+		return &os.PathError{Op: "removeall", Path: path, Err: flt.err}
+	}
+	if err := f.fs.RemoveAll(path); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.move(filepath.Clean(path), "", false)
+	return nil
+}
+
+func (f *faultFS) Rename(oldpath, newpath string) error {
+	if flt := f.fault("rename", newpath); flt != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: flt.err}
+	}
+	if err := f.fs.Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.move(filepath.Clean(newpath), "", false)
+	f.move(filepath.Clean(oldpath), filepath.Clean(newpath), false)
+	return nil
+}
+
+func (f *faultFS) Link(oldname, newname string) error {
+	if err := f.fs.Link(oldname, newname); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.move(filepath.Clean(oldname), filepath.Clean(newname), true)
+	return nil
+}
+
+func (f *faultFS) Stat(name string) (os.FileInfo, error)      { return f.fs.Stat(name) }
+func (f *faultFS) Lstat(name string) (os.FileInfo, error)     { return f.fs.Lstat(name) }
+func (f *faultFS) ReadDir(name string) ([]os.DirEntry, error) { return f.fs.ReadDir(name) }
+
+// faultFile is a file of a faultFS
+type faultFile struct {
+	memoria.File
+	fs  *faultFS
+	ino *inode // nil for directories
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if flt := f.fs.fault("write", f.Name()); flt != nil {
+		if flt.short {
+			n, _ := f.File.Write(p[:len(p)/2])
+			return n, flt.err
+		}
+		return 0, flt.err
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error) {
+	if flt := f.fs.fault("write", f.Name()); flt != nil {
+		if flt.short {
+			n, _ := f.File.WriteAt(p[:len(p)/2], off)
+			return n, flt.err
+		}
+		return 0, flt.err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+// Sync makes the data of a file durable, or the entries of a directory
+func (f *faultFile) Sync() error {
+	if flt := f.fs.fault("sync", f.Name()); flt != nil {
+		return flt.err
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.ino != nil {
+		path, ok := f.fs.pathOf(f.ino)
+		if !ok {
+			return nil // removed while open
+		}
+		data, err := readAll(f.fs.fs, path)
+		if err != nil {
+			return err
+		}
+		f.ino.durable = data
+		return nil
+	}
+
+	name := filepath.Clean(f.Name())
+	entries := make(map[string]*inode)
+	for path, ino := range f.fs.inodes {
+		if filepath.Dir(path) == name {
+			entries[filepath.Base(path)] = ino
+		}
+	}
+	f.fs.synced[name] = entries
+	return nil
+}
+
+// Close closes the file even when it fails, as close(2) does
+func (f *faultFile) Close() error {
+	err := f.File.Close()
+	if flt := f.fs.fault("close", f.Name()); flt != nil {
+		return flt.err
+	}
+	return err
+}
+
+func readAll(fsys memoria.FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,189 @@
+//go:build unix
+
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func openLocked(t *testing.T, dir string, mode memoria.LockMode) (*memoria.Memoria, error) {
+	t.Helper()
+	m, err := memoria.Open(memoria.Options{}, memoria.WithDir(dir), memoria.WithLock(mode))
+	if err == nil {
+		t.Cleanup(func() { m.Close() })
+	}
+	return m, err
+}
+
+func TestLockModesConflict(t *testing.T) {
+	tests := []struct {
+		held, opened memoria.LockMode
+		conflict     bool
+	}{
+		{memoria.LockExclusive, memoria.LockExclusive, true},
+		{memoria.LockExclusive, memoria.LockReadOnly, true},
+		{memoria.LockExclusive, memoria.LockNone, false},
+		{memoria.LockReadOnly, memoria.LockExclusive, true},
+		{memoria.LockSingleWriter, memoria.LockReadOnly, false},
+		{memoria.LockSingleWriter, memoria.LockSingleWriter, true},
+		{memoria.LockSingleWriter, memoria.LockSharedWriters, true},
+		{memoria.LockSharedWriters, memoria.LockSharedWriters, false},
+		{memoria.LockSharedWriters, memoria.LockReadOnly, false},
+		{memoria.LockReadOnly, memoria.LockReadOnly, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.held.String()+" then "+tt.opened.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := openLocked(t, dir, tt.held); err != nil {
+				t.Fatalf("Open(%s) error = %v", tt.held, err)
+			}
+			_, err := openLocked(t, dir, tt.opened)
+			if tt.conflict && !errors.Is(err, memoria.ErrStoreLocked) {
+				t.Errorf("Open(%s) error = %v, want ErrStoreLocked", tt.opened, err)
+			}
+			if !tt.conflict && err != nil {
+				t.Errorf("Open(%s) error = %v", tt.opened, err)
+			}
+		})
+	}
+}
+
+func TestLockReleasedOnClose(t *testing.T) {
+	dir := t.TempDir()
+	m, err := openLocked(t, dir, memoria.LockExclusive)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// EraseAll keeps the lock files
+	if err := m.EraseAll(); err != nil {
+		t.Fatalf("EraseAll() error = %v", err)
+	}
+	if _, err := openLocked(t, dir, memoria.LockExclusive); !errors.Is(err, memoria.ErrStoreLocked) {
+		t.Fatalf("Open() error = %v after EraseAll, want ErrStoreLocked", err)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := openLocked(t, dir, memoria.LockExclusive); err != nil {
+		t.Errorf("Open() error = %v after Close", err)
+	}
+}
+
+func TestLockReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := openLocked(t, dir, memoria.LockSingleWriter)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	reader, err := openLocked(t, dir, memoria.LockReadOnly)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	if err := writer.Write("key", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if val, err := reader.Read("key"); err != nil || string(val) != "value" {
+		t.Errorf("Read() = %q, %v", val, err)
+	}
+
+	_, createErr := reader.Create("key")
+	writes := map[string]error{
+		"Write":    reader.Write("key", []byte("other")),
+		"Erase":    reader.Erase("key"),
+		"EraseAll": reader.EraseAll(),
+		"Create":   createErr,
+	}
+	for name, err := range writes {
+		if !errors.Is(err, memoria.ErrReadOnly) {
+			t.Errorf("%s() error = %v, want ErrReadOnly", name, err)
+		}
+	}
+}
+
+func TestLockReadOnlyUnwritableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write any directory")
+	}
+	dir := t.TempDir()
+	writer, err := openLocked(t, dir, memoria.LockSingleWriter)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := writer.Write("key", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	reader, err := openLocked(t, dir, memoria.LockReadOnly)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if val, err := reader.Read("key"); err != nil || string(val) != "value" {
+		t.Errorf("Read() = %q, %v", val, err)
+	}
+	var snapshot bytes.Buffer
+	if err := reader.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if snapshot.Len() == 0 {
+		t.Errorf("Snapshot() wrote nothing")
+	}
+}
+
+func TestLockSharedWriters(t *testing.T) {
+	dir := t.TempDir()
+	stores := make([]*memoria.Memoria, 2)
+	for i := range stores {
+		m, err := openLocked(t, dir, memoria.LockSharedWriters)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		stores[i] = m
+	}
+	if err := stores[0].Write("shared", nil); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// the key lock file serializes the appends of both stores like two processes
+	const appends = 50
+	var wg sync.WaitGroup
+	for _, m := range stores {
+		wg.Add(1)
+		go func(m *memoria.Memoria) {
+			defer wg.Done()
+			for i := 0; i < appends; i++ {
+				if err := m.WriteWithAppend("shared", []byte("x")); err != nil {
+					t.Errorf("WriteWithAppend() error = %v", err)
+					return
+				}
+			}
+		}(m)
+	}
+	wg.Wait()
+
+	// the cache of a store does not see the writes of the other one
+	r, err := stores[1].ReadStream("shared", true)
+	if err != nil {
+		t.Fatalf("ReadStream() error = %v", err)
+	}
+	defer r.Close()
+	if val, err := io.ReadAll(r); err != nil || len(val) != 2*appends {
+		t.Errorf("read %d bytes, %v, want %d", len(val), err, 2*appends)
+	}
+}
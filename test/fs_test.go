@@ -0,0 +1,308 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func collectKeys(m *memoria.Memoria) []string {
+	keys := []string{}
+	for key := range m.Keys(nil) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestMemFSStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	transform, inverse := memoria.ShardedTransform(2, 1)
+	m, err := memoria.Open(memoria.Options{Basedir: dir, Tempdir: filepath.Join(dir, ".memoria-tmp")},
+		memoria.WithFS(memoria.NewMemFS()),
+		memoria.WithPathTransform(transform, inverse),
+		memoria.WithCompression(memoria.NewGzipCompression()),
+		memoria.WithChecksums(),
+		memoria.WithContentAddressing(),
+		memoria.WithWAL(memoria.WALSyncAlways),
+	)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+
+	if err := m.WriteString("alpha", "first"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.WriteString("beta", "first"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.WriteWithAppend("alpha", []byte(" second")); err != nil {
+		t.Fatalf("WriteWithAppend() error = %v", err)
+	}
+	if err := m.WriteStream("synced", bytes.NewReader([]byte("durable")), false, true); err != nil {
+		t.Fatalf("WriteStream() error = %v", err)
+	}
+	if err := m.WriteWithTTL("session", []byte("short"), time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	for _, result := range m.BulkWrite(map[string][]byte{"bulk1": []byte("1"), "bulk2": []byte("2")}, 2) {
+		if result.Error != nil {
+			t.Fatalf("BulkWrite(%q) error = %v", result.Key, result.Error)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if got, err := m.ReadString("alpha"); err != nil || got != "first second" {
+		t.Fatalf("Read(alpha) = %q, %v, want %q", got, err, "first second")
+	}
+	if _, err := m.Read("session"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Fatalf("Read(session) error = %v, want ErrKeyNotFound", err)
+	}
+	if err := m.Erase("beta"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if m.Has("beta") {
+		t.Fatalf("Has(beta) = true after Erase")
+	}
+
+	// the expired session is no longer listed
+	want := []string{"alpha", "bulk1", "bulk2", "synced"}
+	if got := collectKeys(m); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Keys() = %v, want %v", got, want)
+	}
+	if corrupt, err := m.Scrub(); err != nil || len(corrupt) != 0 {
+		t.Fatalf("Scrub() = %v, %v, want no corrupt keys", corrupt, err)
+	}
+	// the blob beta shared with alpha is only referenced by beta after the append
+	if n, err := m.CollectGarbage(); err != nil || n != 1 {
+		t.Fatalf("CollectGarbage() = %d, %v, want 1", n, err)
+	}
+
+	var snapshot bytes.Buffer
+	if err := m.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := m.EraseAll(); err != nil {
+		t.Fatalf("EraseAll() error = %v", err)
+	}
+	if err := m.Restore(&snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, err := m.ReadString("synced"); err != nil || got != "durable" {
+		t.Fatalf("Read(synced) after Restore = %q, %v, want %q", got, err, "durable")
+	}
+
+	report, err := m.Check(context.Background())
+	if err != nil || len(report.Problems) != 0 {
+		t.Fatalf("Check() = %v, %v, want no problems", report.Problems, err)
+	}
+
+	// nothing is written to the disk
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat(Basedir) error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestMemFSStoresAreIndependent(t *testing.T) {
+	first := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS()})
+	second := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS()})
+
+	if err := first.WriteString("key", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if second.Has("key") {
+		t.Fatalf("Has() = true on another in-memory FS")
+	}
+
+	// a store reopened on the same FS sees the values
+	reopened := memoria.New(memoria.Options{Basedir: "store", FS: first.FS, MaxCacheSize: 1})
+	if got, err := reopened.ReadString("key"); err != nil || got != "value" {
+		t.Fatalf("Read() = %q, %v, want %q", got, err, "value")
+	}
+}
+
+func TestOpenMemFSWithLock(t *testing.T) {
+	_, err := memoria.Open(memoria.Options{Basedir: "store"},
+		memoria.WithFS(memoria.NewMemFS()), memoria.WithLock(memoria.LockExclusive))
+	if err == nil {
+		t.Fatalf("Open() with a lock on an in-memory FS succeeded")
+	}
+}
+
+func TestReadOnlyFS(t *testing.T) {
+	dir := t.TempDir()
+	src, err := memoria.Open(memoria.Options{Basedir: dir},
+		memoria.WithCompression(memoria.NewZlibCompression()), memoria.WithChecksums())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := src.WriteString("alpha", "first"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := src.WriteWithTTL("session", []byte("later"), time.Hour); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	src.Close()
+
+	m, err := memoria.Open(memoria.Options{Basedir: ".", SweepInterval: time.Millisecond},
+		memoria.WithFS(memoria.NewReadOnlyFS(os.DirFS(dir))),
+		memoria.WithCompression(memoria.NewZlibCompression()), memoria.WithChecksums())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+
+	if got, err := m.ReadString("alpha"); err != nil || got != "first" {
+		t.Fatalf("Read(alpha) = %q, %v, want %q", got, err, "first")
+	}
+	if ttl, err := m.TTL("session"); err != nil || ttl <= 0 {
+		t.Fatalf("TTL(session) = %v, %v, want a positive ttl", ttl, err)
+	}
+	if got, want := collectKeys(m), []string{"alpha", "session"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Keys() = %v, want %v", got, want)
+	}
+	if err := m.Verify("alpha"); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if err := m.WriteString("beta", "second"); !errors.Is(err, memoria.ErrReadOnly) {
+		t.Fatalf("Write() error = %v, want ErrReadOnly", err)
+	}
+	if err := m.Erase("alpha"); !errors.Is(err, memoria.ErrReadOnly) {
+		t.Fatalf("Erase() error = %v, want ErrReadOnly", err)
+	}
+	if err := m.EraseAll(); !errors.Is(err, memoria.ErrReadOnly) {
+		t.Fatalf("EraseAll() error = %v, want ErrReadOnly", err)
+	}
+
+	// nothing can change a read only store so its snapshot needs no temp files
+	var snapshot bytes.Buffer
+	if err := m.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	dst, err := memoria.Open(memoria.Options{Basedir: "copy"}, memoria.WithFS(memoria.NewMemFS()))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := dst.Restore(&snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, err := dst.ReadString("session"); err != nil || got != "later" {
+		t.Fatalf("Read(session) after Restore = %q, %v, want %q", got, err, "later")
+	}
+}
+
+func TestReadOnlyFSFromMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data/ab/abc":   {Data: []byte("value")},
+		"data/pl/plain": {Data: []byte("plain")},
+	}
+	m, err := memoria.Open(memoria.Options{Basedir: "data"},
+		memoria.WithFS(memoria.NewReadOnlyFS(fsys)),
+		memoria.WithPathTransform(memoria.ShardedTransform(2, 1)))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	rc, err := m.ReadStream("abc", true)
+	if err != nil {
+		t.Fatalf("ReadStream() error = %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	if err != nil || string(got) != "value" {
+		t.Fatalf("ReadStream() = %q, %v, want %q", got, err, "value")
+	}
+	if _, err := m.Read("missing"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Fatalf("Read(missing) error = %v, want ErrKeyNotFound", err)
+	}
+	if !m.Has("plain") {
+		t.Fatalf("Has(plain) = false")
+	}
+
+	if _, err := memoria.Open(memoria.Options{Basedir: "nowhere"}, memoria.WithFS(memoria.NewReadOnlyFS(fsys))); err == nil {
+		t.Fatalf("Open() with a missing Basedir succeeded")
+	}
+}
+
+func TestMemFSFiles(t *testing.T) {
+	fsys := memoria.NewMemFS()
+	if err := fsys.MkdirAll("a/b", 0777); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	f, err := fsys.OpenFile("a/b/file", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	if _, err := f.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := f.WriteAt([]byte("W"), 6); err != nil {
+		t.Fatalf("WriteAt() error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("Write() after Close error = %v, want ErrClosed", err)
+	}
+
+	if err := fsys.Link("a/b/file", "a/link"); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	old, err := fsys.Open("a/b/file")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer old.Close()
+
+	// a file renamed over another leaves its links and open files alone
+	replacement, err := fsys.CreateTemp("a/b", "tmp-*", 0666)
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	replacement.Write([]byte("replaced"))
+	replacement.Close()
+	if err := fsys.Rename(replacement.Name(), "a/b/file"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+
+	for name, want := range map[string]string{"a/b/file": "replaced", "a/link": "hello World"} {
+		f, err := fsys.Open(name)
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", name, err)
+		}
+		got, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || string(got) != want {
+			t.Fatalf("ReadAll(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if got, err := io.ReadAll(old); err != nil || string(got) != "hello World" {
+		t.Fatalf("ReadAll() of the replaced file = %q, %v, want %q", got, err, "hello World")
+	}
+
+	entries, err := fsys.ReadDir("a")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "b" || entries[1].Name() != "link" {
+		t.Fatalf("ReadDir() = %v, %v, want [b link]", entries, err)
+	}
+	if err := fsys.Remove("a"); err == nil {
+		t.Fatalf("Remove() of a directory which is not empty succeeded")
+	}
+	if err := fsys.RemoveAll("a"); err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	if _, err := fsys.Stat("a/link"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Stat() after RemoveAll error = %v, want ErrNotExist", err)
+	}
+}
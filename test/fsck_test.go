@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func newFsckStore(t *testing.T, dir string) *memoria.Memoria {
+	t.Helper()
+	transform, inverse := memoria.ShardedTransform(2, 1)
+	return memoria.New(memoria.Options{
+		Basedir:              dir,
+		Checksum:             true,
+		PathTransform:        transform,
+		InversePathTransform: inverse,
+	})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckAndRepair(t *testing.T) {
+	dir := t.TempDir()
+	m := newFsckStore(t, dir)
+	for _, key := range []string{"good", "corrupt", "empty"} {
+		if err := m.Write(key, []byte("value of "+key)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// the damage a crash leaves behind
+	writeFile(t, filepath.Join(dir, "go", ".memoria-tmp-1"), []byte("partial"))
+	writeFile(t, filepath.Join(dir, "co", "corrupt"), append([]byte{0, 'M', 'C', 'S', 1, 2, 3, 4}, "garbage"...))
+	writeFile(t, filepath.Join(dir, "em", "empty"), nil)
+	writeFile(t, filepath.Join(dir, "xy", "misplaced"), []byte("stored under the wrong shard"))
+	writeFile(t, filepath.Join(dir, "go", ".memoria-ttl-gone"), []byte("0"))
+	if err := os.MkdirAll(filepath.Join(dir, "zz", "deeper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := m.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	want := map[memoria.ProblemKind]int{
+		memoria.ProblemTempFile:     1,
+		memoria.ProblemCorrupt:      1,
+		memoria.ProblemEmptyFile:    1,
+		memoria.ProblemBadKey:       1,
+		memoria.ProblemOrphanExpiry: 1,
+		memoria.ProblemEmptyDir:     1, // zz is not empty until deeper is pruned
+	}
+	for kind, n := range want {
+		if got := report.Count(kind); got != n {
+			t.Errorf("Check() found %d problems of kind %s, want %d: %v", got, kind, n, report.Problems)
+		}
+	}
+	if report.Keys != 4 {
+		t.Errorf("Check() checked %d keys, want 4", report.Keys)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go", ".memoria-tmp-1")); err != nil {
+		t.Errorf("Check() changed the store: %v", err)
+	}
+
+	report, err = m.Repair(context.Background())
+	if err != nil {
+		t.Fatalf("Repair() error = %v", err)
+	}
+	if n := report.Unrepaired(); n != 0 {
+		t.Errorf("Repair() left %d problems: %v", n, report.Problems)
+	}
+
+	for _, path := range []string{"co/corrupt", "em/empty", "xy/misplaced"} {
+		if _, err := os.Stat(filepath.Join(dir, ".memoria-lost+found", path)); err != nil {
+			t.Errorf("%s was not moved to lost+found: %v", path, err)
+		}
+	}
+	for _, key := range []string{"corrupt", "empty"} {
+		if _, err := m.Read(key); !errors.Is(err, memoria.ErrKeyNotFound) {
+			t.Errorf("Read(%q) error = %v after Repair, want ErrKeyNotFound", key, err)
+		}
+	}
+	if val, err := m.Read("good"); err != nil || string(val) != "value of good" {
+		t.Errorf("Read() = %q, %v after Repair", val, err)
+	}
+
+	report, err = m.Check(context.Background())
+	if err != nil || len(report.Problems) != 0 {
+		t.Errorf("Check() after Repair = %v, %v, want no problems", report.Problems, err)
+	}
+}
+
+func TestRepairKeepsTempFilesInUse(t *testing.T) {
+	dir := t.TempDir()
+	m := memoria.New(memoria.Options{Basedir: dir})
+
+	w, err := m.Create("key")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	w.Write([]byte("in flight"))
+
+	report, err := m.Repair(context.Background())
+	if err != nil || len(report.Problems) != 0 {
+		t.Errorf("Repair() = %v, %v, want the open writer left alone", report.Problems, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if val, err := m.Read("key"); err != nil || string(val) != "in flight" {
+		t.Errorf("Read() = %q, %v", val, err)
+	}
+}
+
+func TestCheckCancelled(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir()})
+	m.Write("key", []byte("value"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Check(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Check() error = %v, want context.Canceled", err)
+	}
+}
@@ -1 +1,111 @@
 package test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestBTreeIndex(t *testing.T) {
+	index := memoria.NewBTreeIndex()
+	reference := map[string]bool{}
+	rnd := rand.New(rand.NewSource(1))
+
+	// enough operations to split and merge nodes several levels deep
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("key%05d", rnd.Intn(5000))
+		if rnd.Intn(3) == 0 {
+			index.Delete(key)
+			delete(reference, key)
+		} else {
+			index.Insert(key)
+			reference[key] = true
+		}
+	}
+
+	want := make([]string, 0, len(reference))
+	for key := range reference {
+		want = append(want, key)
+	}
+	sort.Strings(want)
+
+	if index.Len() != len(want) {
+		t.Errorf("Len() = %d, want %d", index.Len(), len(want))
+	}
+
+	// page through the whole index
+	got := []string{}
+	for from := ""; ; {
+		page := index.Keys(from, 100)
+		if len(page) == 0 {
+			break
+		}
+		got = append(got, page...)
+		from = page[len(page)-1]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() returned %d keys, want %d in order", len(got), len(want))
+	}
+
+	// pages start right after a key that is not in the index
+	if page := index.Keys(want[10]+"~", 1); len(page) != 1 || page[0] != want[11] {
+		t.Errorf("Keys() got = %v, want [%s]", page, want[11])
+	}
+
+	for _, key := range want {
+		index.Delete(key)
+	}
+	if index.Len() != 0 || len(index.Keys("", 10)) != 0 {
+		t.Errorf("index not empty after deleting every key")
+	}
+}
+
+func TestMemoriaIndex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	before := memoria.New(memoria.Options{Basedir: tempDir, MaxCacheSize: 1024})
+	for _, key := range []string{"c", "a", "b"} {
+		if err := before.WriteString(key, "value"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// the index is initialized from the keys already on disk
+	m := memoria.New(memoria.Options{
+		Basedir:      tempDir,
+		MaxCacheSize: 1024,
+		Index:        memoria.NewBTreeIndex(),
+	})
+	if got := m.Index.Keys("", 10); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Keys() after startup got = %v, want [a b c]", got)
+	}
+
+	if err := m.WriteString("d", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.Erase("a"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if got := m.Index.Keys("", 10); !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Errorf("Keys() after Write and Erase got = %v, want [b c d]", got)
+	}
+	if got := m.Index.Keys("b", 1); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("Keys(b, 1) got = %v, want [c]", got)
+	}
+
+	if err := m.EraseAll(); err != nil {
+		t.Fatalf("EraseAll() error = %v", err)
+	}
+	if got := m.Index.Keys("", 10); len(got) != 0 {
+		t.Errorf("Keys() after EraseAll got = %v, want []", got)
+	}
+}
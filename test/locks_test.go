@@ -0,0 +1,152 @@
+package test
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestSlowWriteDoesNotBlockStore(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024})
+	if err := m.Write("cached", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// the upload stalls until the pipe is written to
+	pr, pw := io.Pipe()
+	uploaded := make(chan error, 1)
+	go func() { uploaded <- m.WriteStream("upload", pr, false, false) }()
+
+	done := make(chan error, 1)
+	go func() {
+		if _, err := m.Read("cached"); err != nil {
+			done <- err
+			return
+		}
+		if err := m.Write("other", []byte("value")); err != nil {
+			done <- err
+			return
+		}
+		done <- m.Erase("other")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("store operation failed during an upload: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("a stalled upload blocked the store")
+	}
+
+	pw.Write([]byte("uploaded"))
+	pw.Close()
+	if err := <-uploaded; err != nil {
+		t.Fatalf("WriteStream() error = %v", err)
+	}
+	if val, err := m.Read("upload"); err != nil || string(val) != "uploaded" {
+		t.Errorf("Read() = %q, %v", val, err)
+	}
+}
+
+func TestConcurrentWritesOfOneKey(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024})
+	if err := m.Write("shared", nil); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	const writers, appends = 8, 32
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		go func() {
+			for i := 0; i < appends; i++ {
+				if err := m.WriteWithAppend("shared", []byte("x")); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for w := 0; w < writers; w++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("WriteWithAppend() error = %v", err)
+		}
+	}
+
+	// writes of one key are serialized so no append is lost
+	val, err := m.Read("shared")
+	if err != nil || len(val) != writers*appends {
+		t.Errorf("Read() = %d bytes, %v, want %d", len(val), err, writers*appends)
+	}
+}
+
+// stallFS stalls the first sync of a directory of the blob store until release is closed
+type stallFS struct {
+	memoria.FS
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (s *stallFS) Open(name string) (memoria.File, error) {
+	f, err := s.FS.Open(name)
+	if err != nil || !strings.Contains(filepath.ToSlash(name), ".memoria-blobs/") {
+		return f, err
+	}
+	return &stallFile{File: f, fs: s}, nil
+}
+
+type stallFile struct {
+	memoria.File
+	fs *stallFS
+}
+
+func (f *stallFile) Sync() error {
+	select {
+	case <-f.fs.stalled:
+	default:
+		close(f.fs.stalled)
+		<-f.fs.release
+	}
+	return f.File.Sync()
+}
+
+func TestSyncedBlobWriteDoesNotBlockStore(t *testing.T) {
+	fsys := &stallFS{FS: memoria.NewMemFS(), stalled: make(chan struct{}), release: make(chan struct{})}
+	m := memoria.New(memoria.Options{Basedir: "store", FS: fsys, ContentAddressed: true, MaxCacheSize: 1024})
+	if err := m.Write("other", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	written := make(chan error, 1)
+	go func() { written <- m.WriteStream("key", strings.NewReader("synced"), false, true) }()
+	<-fsys.stalled
+
+	done := make(chan error, 1)
+	go func() {
+		if _, err := readBypassingCache(m, "other"); err != nil {
+			done <- err
+			return
+		}
+		done <- m.Write("another", []byte("value"))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("store operation failed during a synced write: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("syncing a blob blocked the store")
+	}
+
+	close(fsys.release)
+	if err := <-written; err != nil {
+		t.Fatalf("WriteStream() error = %v", err)
+	}
+	if val, err := readBypassingCache(m, "key"); err != nil || string(val) != "synced" {
+		t.Errorf("Read() = %q, %v", val, err)
+	}
+}
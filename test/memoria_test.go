@@ -2,7 +2,13 @@ package test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -275,3 +281,273 @@ func TestMemoriaBulkWrite(t *testing.T) {
 		})
 	}
 }
+
+// failingReader returns data until limit bytes have been read and then fails
+type failingReader struct {
+	data  []byte
+	limit int
+	read  int
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.read >= fr.limit {
+		return 0, errors.New("reader failed")
+	}
+	n := copy(p, fr.data[fr.read:fr.limit])
+	fr.read += n
+	return n, nil
+}
+
+// assertNoTempFiles fails the test if any temp files were left behind in dir
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".memoria-tmp-") {
+			t.Errorf("temp file left behind: %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk %s: %v", dir, err)
+	}
+}
+
+func TestMemoriaAtomicWrite(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name    string
+		tempdir string
+		append  bool
+		want    string
+	}{
+		{
+			name: "Failed write keeps old value",
+			want: "old value",
+		},
+		{
+			name:   "Failed append keeps old value",
+			append: true,
+			want:   "old value",
+		},
+		{
+			name:    "Failed write with Tempdir keeps old value",
+			tempdir: filepath.Join(tempDir, "tmp"),
+			want:    "old value",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := memoria.New(memoria.Options{
+				Basedir:      filepath.Join(tempDir, strconv.Itoa(i)),
+				Tempdir:      tt.tempdir,
+				MaxCacheSize: 1024,
+			})
+
+			if err := m.WriteString("key", "old value"); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			r := &failingReader{data: bytes.Repeat([]byte("x"), 10000), limit: 5000}
+			if err := m.WriteStream("key", r, tt.append, true); err == nil {
+				t.Fatalf("WriteStream() expected error from failing reader")
+			}
+
+			got, err := m.ReadString("key")
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Read() got = %q, want %q", got, tt.want)
+			}
+
+			assertNoTempFiles(t, m.Basedir)
+			if tt.tempdir != "" {
+				assertNoTempFiles(t, tt.tempdir)
+			}
+		})
+	}
+}
+
+func TestMemoriaWriteWithAppend(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	m := memoria.New(memoria.Options{
+		Basedir:      tempDir,
+		MaxCacheSize: 1024,
+	})
+
+	if err := m.WriteWithAppend("missing", []byte("value")); err == nil {
+		t.Errorf("WriteWithAppend() expected error for missing key")
+	}
+
+	if err := m.WriteString("key", "hello"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// populate the cache so the append has to invalidate it
+	if _, err := m.Read("key"); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if err := m.WriteWithAppend("key", []byte(" world")); err != nil {
+		t.Fatalf("WriteWithAppend() error = %v", err)
+	}
+
+	got, err := m.ReadString("key")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got != "hello world" {
+		t.Errorf("Read() got = %q, want %q", got, "hello world")
+	}
+	assertNoTempFiles(t, tempDir)
+}
+
+func TestMemoriaEraseHas(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// splits "abcdef" into ab/cd/abcdef
+	transform := func(key string) *memoria.PathKey {
+		return &memoria.PathKey{Path: []string{key[0:2], key[2:4]}, FileName: key}
+	}
+
+	m := memoria.New(memoria.Options{
+		Basedir:       tempDir,
+		MaxCacheSize:  1024,
+		PathTransform: transform,
+	})
+
+	if err := m.WriteString("abcdef", "first"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.WriteString("abcxyz", "second"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// populate the cache so Erase has to evict it
+	if _, err := m.Read("abcdef"); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if !m.Has("abcdef") {
+		t.Errorf("Has() = false, want true")
+	}
+	if m.Has("abzzzz") {
+		t.Errorf("Has() = true for missing key, want false")
+	}
+
+	if err := m.Erase("abcdef"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if m.Has("abcdef") {
+		t.Errorf("Has() = true after Erase, want false")
+	}
+	if _, err := m.Read("abcdef"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("Read() after Erase error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ab", "cd")); !os.IsNotExist(err) {
+		t.Errorf("empty directory ab/cd was not pruned")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "ab", "cx")); err != nil {
+		t.Errorf("directory ab/cx of a live key was removed: %v", err)
+	}
+
+	if err := m.Erase("abcdef"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("Erase() missing key error = %v, want ErrKeyNotFound", err)
+	}
+
+	if err := m.EraseAll(); err != nil {
+		t.Fatalf("EraseAll() error = %v", err)
+	}
+	if m.Has("abcxyz") {
+		t.Errorf("Has() = true after EraseAll, want false")
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Basedir removed by EraseAll: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("EraseAll() left %d entries in Basedir", len(entries))
+	}
+}
+
+func TestMemoriaKeys(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	m := memoria.New(memoria.Options{
+		Basedir:      tempDir,
+		MaxCacheSize: 1024,
+		PathTransform: func(key string) *memoria.PathKey {
+			return &memoria.PathKey{Path: []string{key[0:2]}, FileName: key[2:]}
+		},
+		InversePathTransform: func(pathKey *memoria.PathKey) string {
+			return strings.Join(pathKey.Path, "") + pathKey.FileName
+		},
+	})
+
+	want := []string{"aa1", "aa2", "ab1", "bb1"}
+	for _, key := range want {
+		if err := m.WriteString(key, "value"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// internal files must not show up as keys
+	for _, name := range []string{"backup.dump", ".memoria-tmp-123"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("x"), 0666); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	collect := func(c <-chan string) []string {
+		keys := []string{}
+		for key := range c {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	if got := collect(m.Keys(nil)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() got = %v, want %v", got, want)
+	}
+	if got := collect(m.KeysPrefix("aa", nil)); !reflect.DeepEqual(got, []string{"aa1", "aa2"}) {
+		t.Errorf("KeysPrefix() got = %v, want %v", got, []string{"aa1", "aa2"})
+	}
+
+	// cancelling after the first key closes the channel early
+	for i := 0; i < 100; i++ {
+		if err := m.WriteString(fmt.Sprintf("cc%03d", i), "value"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	cancel := make(chan struct{})
+	c := m.Keys(cancel)
+	<-c
+	close(cancel)
+	n := 0
+	for range c {
+		n++
+	}
+	if n >= len(want)+99 {
+		t.Errorf("Keys() yielded all %d remaining keys after cancel", n)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestOpen(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dir := filepath.Join(tempDir, "nested", "store")
+	m, err := memoria.Open(memoria.Options{},
+		memoria.WithDir(dir),
+		memoria.WithCacheSize(2048),
+		memoria.WithCachePolicy(memoria.NewLRUCachePolicy()),
+		memoria.WithCompression(memoria.NewGzipCompression()),
+		memoria.WithFilePerm(0640),
+		memoria.WithPathPerm(0750),
+		memoria.WithBufferSize(16),
+	)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+
+	if m.Basedir != dir || m.MaxCacheSize != 2048 {
+		t.Errorf("Open() did not apply options: Basedir = %s, MaxCacheSize = %d", m.Basedir, m.MaxCacheSize)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("Open() did not create Basedir: %v", err)
+	}
+	// the umask may only take permissions away
+	if info.Mode().Perm()&^0750 != 0 {
+		t.Errorf("Basedir permissions = %v, want at most %v", info.Mode().Perm(), os.FileMode(0750))
+	}
+
+	// the value is larger than the buffer so it is copied in several chunks
+	if err := m.WriteString("key", "a value larger than sixteen bytes"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got, err := m.ReadString("key")
+	if err != nil || got != "a value larger than sixteen bytes" {
+		t.Errorf("Read() got = %q, %v", got, err)
+	}
+
+	info, err = os.Stat(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatalf("Failed to stat key file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("key file permissions = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestOpenInvalidDir(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := filepath.Join(tempDir, "file")
+	if err := os.WriteFile(file, []byte("x"), 0666); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, err := memoria.Open(memoria.Options{}, memoria.WithDir(file)); err == nil {
+		t.Errorf("Open() on a file expected error")
+	}
+	if _, err := memoria.Open(memoria.Options{}, memoria.WithDir(filepath.Join(file, "store"))); err == nil {
+		t.Errorf("Open() below a file expected error")
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	readOnly := filepath.Join(tempDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if _, err := memoria.Open(memoria.Options{}, memoria.WithDir(readOnly)); err == nil {
+		t.Errorf("Open() on a read-only directory expected error")
+	}
+}
+
+func TestDefaultFilePermHonoursUmask(t *testing.T) {
+	dir := t.TempDir()
+	m := memoria.New(memoria.Options{Basedir: dir})
+	if err := m.WriteString("key", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// a file created with the default permissions has them masked by the umask
+	want, err := os.OpenFile(filepath.Join(dir, "want"), os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	want.Close()
+	wantInfo, err := os.Stat(want.Name())
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "key"))
+	if err != nil {
+		t.Fatalf("Failed to stat key file: %v", err)
+	}
+	if info.Mode().Perm() != wantInfo.Mode().Perm() {
+		t.Errorf("key file permissions = %v, want %v", info.Mode().Perm(), wantInfo.Mode().Perm())
+	}
+}
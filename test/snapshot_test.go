@@ -0,0 +1,184 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func newSnapshotStore(t *testing.T, compression memoria.Compression) *memoria.Memoria {
+	t.Helper()
+	return memoria.New(memoria.Options{
+		Basedir:      t.TempDir(),
+		MaxCacheSize: 1024,
+		Compression:  compression,
+		PathTransform: func(key string) *memoria.PathKey {
+			return &memoria.PathKey{Path: []string{key[:1]}, FileName: key}
+		},
+		InversePathTransform: func(pathKey *memoria.PathKey) string {
+			return pathKey.FileName
+		},
+	})
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	src := newSnapshotStore(t, memoria.NewGzipCompression())
+
+	values := map[string][]byte{
+		"alpha": []byte("first"),
+		"beta":  {},
+		"big":   bytes.Repeat([]byte("0123456789"), 10000), // larger than a chunk
+	}
+	for key, val := range values {
+		if err := src.Write(key, val); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := src.WriteWithTTL("session", []byte("expiring"), time.Hour); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	if err := src.WriteWithTTL("gone", []byte("expired"), time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var snapshot bytes.Buffer
+	if err := src.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	dst := newSnapshotStore(t, nil)
+	if err := dst.WriteString("kept", "not in the snapshot"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := dst.Restore(&snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	for key, want := range values {
+		got, err := dst.Read(key)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Read(%s) after Restore = %d bytes, %v, want %d bytes", key, len(got), err, len(want))
+		}
+	}
+	if ttl, err := dst.TTL("session"); err != nil || ttl == memoria.NoExpiry || ttl <= 59*time.Minute {
+		t.Errorf("TTL(session) after Restore = %v, %v, want about an hour", ttl, err)
+	}
+	if dst.Has("gone") {
+		t.Errorf("expired key was restored")
+	}
+	if !dst.Has("kept") {
+		t.Errorf("Restore() removed a key missing from the snapshot")
+	}
+}
+
+// hookWriter calls hook before the first write
+type hookWriter struct {
+	w    io.Writer
+	hook func()
+}
+
+func (hw *hookWriter) Write(p []byte) (int, error) {
+	if hw.hook != nil {
+		hw.hook()
+		hw.hook = nil
+	}
+	return hw.w.Write(p)
+}
+
+func TestSnapshotIsConsistentDuringWrites(t *testing.T) {
+	m := newSnapshotStore(t, nil)
+	if err := m.WriteString("alpha", "before"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var snapshot bytes.Buffer
+	w := &hookWriter{w: &snapshot, hook: func() {
+		done := make(chan error)
+		go func() { done <- m.WriteString("alpha", "after") }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Write() during Snapshot error = %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Write() blocked while the snapshot was streamed")
+		}
+	}}
+	if err := m.Snapshot(w); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	restored := newSnapshotStore(t, nil)
+	if err := restored.Restore(&snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, _ := restored.ReadString("alpha"); got != "before" {
+		t.Errorf("snapshot has %q, want the value from when it was taken", got)
+	}
+	if got, _ := m.ReadString("alpha"); got != "after" {
+		t.Errorf("store has %q, want the value written during the snapshot", got)
+	}
+}
+
+func TestRestoreBadSnapshot(t *testing.T) {
+	src := newSnapshotStore(t, nil)
+	if err := src.WriteString("alpha", strings.Repeat("value", 10)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var snapshot bytes.Buffer
+	if err := src.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	good := snapshot.Bytes()
+
+	corrupt := append([]byte(nil), good...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not a snapshot", data: []byte("hello")},
+		{name: "truncated", data: good[:len(good)-6]},
+		{name: "corrupt", data: corrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := newSnapshotStore(t, nil)
+			if err := dst.Restore(bytes.NewReader(tt.data)); !errors.Is(err, memoria.ErrBadSnapshot) {
+				t.Errorf("Restore() error = %v, want ErrBadSnapshot", err)
+			}
+			if dst.Has("alpha") {
+				t.Errorf("bad snapshot was partially restored")
+			}
+		})
+	}
+}
+
+func TestRestoreInvalidKey(t *testing.T) {
+	src := newSnapshotStore(t, nil)
+	if err := src.WriteString("alpha", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var snapshot bytes.Buffer
+	if err := src.Snapshot(&snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	dst := memoria.New(memoria.Options{
+		Basedir: t.TempDir(),
+		PathTransform: func(key string) *memoria.PathKey {
+			return &memoria.PathKey{Path: []string{".."}, FileName: key}
+		},
+	})
+	if err := dst.Restore(&snapshot); !errors.Is(err, memoria.ErrInvalidKey) {
+		t.Errorf("Restore() error = %v, want ErrInvalidKey", err)
+	}
+}
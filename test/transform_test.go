@@ -0,0 +1,299 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestShardedTransform(t *testing.T) {
+	transform, inverse := memoria.ShardedTransform(2, 2)
+
+	tests := []struct {
+		key  string
+		path []string
+	}{
+		{"abcdef", []string{"ab", "cd"}},
+		{"abcd", []string{"ab", "cd"}},
+		{"abc", []string{"ab"}},
+		{"a", []string{}},
+	}
+	for _, tt := range tests {
+		pathKey := transform(tt.key)
+		if !reflect.DeepEqual(pathKey.Path, tt.path) || pathKey.FileName != tt.key {
+			t.Errorf("transform(%q) = %v/%s, want %v/%s", tt.key, pathKey.Path, pathKey.FileName, tt.path, tt.key)
+		}
+		if got := inverse(pathKey); got != tt.key {
+			t.Errorf("inverse(transform(%q)) = %q", tt.key, got)
+		}
+	}
+}
+
+func TestHashedTransform(t *testing.T) {
+	transform, inverse := memoria.HashedTransform(2, 3)
+
+	pathKey := transform("user-1")
+	if len(pathKey.Path) != 3 {
+		t.Fatalf("Path = %v, want 3 levels", pathKey.Path)
+	}
+	for _, dir := range pathKey.Path {
+		if len(dir) != 2 {
+			t.Errorf("Path = %v, want levels of 2 characters", pathKey.Path)
+		}
+	}
+	if got := inverse(pathKey); got != "user-1" {
+		t.Errorf("inverse(transform(%q)) = %q", "user-1", got)
+	}
+	if reflect.DeepEqual(transform("user-2").Path, pathKey.Path) {
+		t.Errorf("keys with a common prefix share the path %v", pathKey.Path)
+	}
+}
+
+func TestEscapedTransform(t *testing.T) {
+	transform, inverse := memoria.EscapedTransform()
+
+	keys := []string{
+		"plain-key_1.txt",
+		"../../etc/passwd",
+		".memoria-wal",
+		"..",
+		"100%",
+		"nul\x00byte",
+		string([]byte{0xff, 0x00, '/', '\\'}),
+		strings.Repeat("long", 200),
+		strings.Repeat("/", 300),
+		strings.Repeat("a", 254) + "..",
+	}
+	for _, key := range keys {
+		pathKey := transform(key)
+		for _, segment := range append(pathKey.Path, pathKey.FileName) {
+			if segment == "" || len(segment) > 255 || strings.HasPrefix(segment, ".") || strings.ContainsAny(segment, "/\\\x00") {
+				t.Errorf("transform(%q) has the unsafe segment %q", key, segment)
+			}
+		}
+		if got := inverse(pathKey); got != key {
+			t.Errorf("inverse(transform(%q)) = %q", key, got)
+		}
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		pathKey *memoria.PathKey
+		want    error
+	}{
+		{"traversal", &memoria.PathKey{FileName: "../../etc/x"}, memoria.ErrPathTraversal},
+		{"dot dot segment", &memoria.PathKey{Path: []string{".."}, FileName: "x"}, memoria.ErrPathTraversal},
+		{"separator in segment", &memoria.PathKey{Path: []string{"a/b"}, FileName: "x"}, memoria.ErrPathTraversal},
+		{"absolute", &memoria.PathKey{Path: []string{"/etc"}, FileName: "x"}, memoria.ErrAbsolutePath},
+		{"empty segment", &memoria.PathKey{Path: []string{"a", ""}, FileName: "x"}, memoria.ErrEmptySegment},
+		{"empty file name", &memoria.PathKey{Path: []string{"a"}}, memoria.ErrEmptySegment},
+		{"nul byte", &memoria.PathKey{FileName: "a\x00b"}, memoria.ErrNULByte},
+		{"too long", &memoria.PathKey{FileName: strings.Repeat("a", 256)}, memoria.ErrNameTooLong},
+		{"internal", &memoria.PathKey{FileName: ".memoria-wal"}, memoria.ErrReservedName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := memoria.New(memoria.Options{
+				Basedir:              filepath.Join(dir, "store"),
+				PathTransform:        func(string) *memoria.PathKey { return tt.pathKey },
+				InversePathTransform: func(pathKey *memoria.PathKey) string { return pathKey.FileName },
+			})
+
+			err := m.Write("key", []byte("value"))
+			var invalid *memoria.InvalidKeyError
+			if !errors.As(err, &invalid) || !errors.Is(err, tt.want) || !errors.Is(err, memoria.ErrInvalidKey) {
+				t.Fatalf("Write() error = %v, want %v", err, tt.want)
+			}
+			if _, err := m.Read("key"); !errors.Is(err, tt.want) {
+				t.Errorf("Read() error = %v, want %v", err, tt.want)
+			}
+			if err := m.Erase("key"); !errors.Is(err, tt.want) {
+				t.Errorf("Erase() error = %v, want %v", err, tt.want)
+			}
+			if m.Has("key") {
+				t.Errorf("Has() = true for an invalid key")
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil || len(entries) > 1 {
+				t.Errorf("files were created outside of Basedir: %v", entries)
+			}
+		})
+	}
+}
+
+func TestTransformsRoundTrip(t *testing.T) {
+	sharded, shardedInverse := memoria.ShardedTransform(2, 2)
+	hashed, hashedInverse := memoria.HashedTransform(2, 2)
+	escaped, escapedInverse := memoria.EscapedTransform()
+
+	tests := []struct {
+		name    string
+		options []memoria.Option
+	}{
+		{"sharded", []memoria.Option{memoria.WithPathTransform(sharded, shardedInverse)}},
+		{"hashed", []memoria.Option{memoria.WithPathTransform(hashed, hashedInverse)}},
+		{"escaped", []memoria.Option{memoria.WithPathTransform(escaped, escapedInverse)}},
+		{"content addressed", []memoria.Option{memoria.WithContentAddressing(), memoria.WithCompression(memoria.NewGzipCompression())}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]memoria.Option{memoria.WithDir(t.TempDir())}, tt.options...)
+			m, err := memoria.Open(memoria.Options{}, options...)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			defer m.Close()
+
+			keys := []string{"a", "abc", "abcdef", "zz-top"}
+			for _, key := range keys {
+				if err := m.Write(key, []byte("value of "+key)); err != nil {
+					t.Fatalf("Write(%q) error = %v", key, err)
+				}
+			}
+			if err := m.WriteWithAppend("abc", []byte("!")); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+
+			got := m.Keys(nil)
+			var listed []string
+			for key := range got {
+				listed = append(listed, key)
+			}
+			sort.Strings(listed)
+			if !reflect.DeepEqual(listed, keys) {
+				t.Errorf("Keys() = %v, want %v", listed, keys)
+			}
+
+			for _, key := range keys {
+				want := "value of " + key
+				if key == "abc" {
+					want += "!"
+				}
+				val, err := readBypassingCache(m, key)
+				if err != nil || string(val) != want {
+					t.Errorf("Read(%q) = %q, %v, want %q", key, val, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestContentAddressedDeduplicates(t *testing.T) {
+	dir := t.TempDir()
+	m, err := memoria.Open(memoria.Options{}, memoria.WithDir(dir), memoria.WithContentAddressing())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+
+	val := bytes.Repeat([]byte("shared"), 1000)
+	for _, key := range []string{"one", "two", "three"} {
+		if err := m.Write(key, val); err != nil {
+			t.Fatalf("Write(%q) error = %v", key, err)
+		}
+	}
+	if got := countBlobs(t, dir); got != 1 {
+		t.Errorf("stored %d blobs for one distinct value, want 1", got)
+	}
+
+	if err := m.Write("two", []byte("changed")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.Erase("three"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if removed, err := m.CollectGarbage(); err != nil || removed != 0 {
+		t.Errorf("CollectGarbage() = %d, %v, want the blob of one kept", removed, err)
+	}
+
+	if err := m.Erase("one"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if removed, err := m.CollectGarbage(); err != nil || removed != 1 {
+		t.Errorf("CollectGarbage() = %d, %v, want 1 removed", removed, err)
+	}
+	if got := countBlobs(t, dir); got != 1 {
+		t.Errorf("%d blobs left, want the blob of two", got)
+	}
+	if val, err := readBypassingCache(m, "two"); err != nil || string(val) != "changed" {
+		t.Errorf("Read() = %q, %v after collecting garbage", val, err)
+	}
+}
+
+func readBypassingCache(m *memoria.Memoria, key string) ([]byte, error) {
+	r, err := m.ReadStream(key, true)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func countBlobs(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	err := filepath.WalkDir(filepath.Join(dir, ".memoria-blobs"), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot walk blobs: %v", err)
+	}
+	return count
+}
+
+func TestContentAddressedMissingBlob(t *testing.T) {
+	dir := t.TempDir()
+	m, err := memoria.Open(memoria.Options{}, memoria.WithDir(dir), memoria.WithContentAddressing())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Write("damaged", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "damaged"), []byte("not a reference"), 0644); err != nil {
+		t.Fatalf("cannot damage reference: %v", err)
+	}
+	if _, err := readBypassingCache(m, "damaged"); !errors.Is(err, memoria.ErrCorrupt) {
+		t.Errorf("Read() of a damaged reference error = %v, want ErrCorrupt", err)
+	}
+	if err := m.Erase("damaged"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+
+	if err := m.Write("lost", []byte("value")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, ".memoria-blobs")); err != nil {
+		t.Fatalf("cannot remove blobs: %v", err)
+	}
+	// the key is still there, only its value is lost
+	if !m.Has("lost") {
+		t.Fatalf("Has() = false for a key whose blob is missing")
+	}
+	if _, err := readBypassingCache(m, "lost"); !errors.Is(err, memoria.ErrCorrupt) {
+		t.Errorf("Read() of a missing blob error = %v, want ErrCorrupt", err)
+	}
+	if err := m.Snapshot(io.Discard); !errors.Is(err, memoria.ErrCorrupt) {
+		t.Errorf("Snapshot() error = %v, want ErrCorrupt", err)
+	}
+}
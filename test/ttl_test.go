@@ -0,0 +1,205 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestMemoriaTTL(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	m := memoria.New(memoria.Options{Basedir: tempDir, MaxCacheSize: 1024})
+
+	if err := m.WriteWithTTL("session", []byte("value"), 50*time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	if err := m.WriteString("forever", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// the first read caches the value, the second is served from the cache
+	for i := 0; i < 2; i++ {
+		if _, err := m.Read("session"); err != nil {
+			t.Fatalf("Read() before expiry error = %v", err)
+		}
+	}
+	if ttl, err := m.TTL("session"); err != nil || ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("TTL() = %v, %v, want between 0 and 50ms", ttl, err)
+	}
+	if ttl, err := m.TTL("forever"); err != nil || ttl != memoria.NoExpiry {
+		t.Errorf("TTL() = %v, %v, want NoExpiry", ttl, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := m.Read("session"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("Read() after expiry error = %v, want ErrKeyNotFound", err)
+	}
+	if m.Has("session") {
+		t.Errorf("Has() = true after expiry, want false")
+	}
+	if _, err := m.TTL("session"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("TTL() after expiry error = %v, want ErrKeyNotFound", err)
+	}
+
+	// the expiry survives a restart
+	if err := m.WriteWithTTL("restart", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	reopened := memoria.New(memoria.Options{Basedir: tempDir, MaxCacheSize: 1024})
+	if _, err := reopened.Read("session"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("Read() after restart error = %v, want ErrKeyNotFound", err)
+	}
+	if ttl, err := reopened.TTL("restart"); err != nil || ttl <= 59*time.Minute {
+		t.Errorf("TTL() after restart = %v, %v, want about an hour", ttl, err)
+	}
+
+	// SetExpiry can remove the expiry and a plain Write clears it
+	if err := reopened.SetExpiry("restart", time.Time{}); err != nil {
+		t.Fatalf("SetExpiry() error = %v", err)
+	}
+	if ttl, _ := reopened.TTL("restart"); ttl != memoria.NoExpiry {
+		t.Errorf("TTL() after removing expiry = %v, want NoExpiry", ttl)
+	}
+	if err := reopened.SetExpiry("restart", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SetExpiry() error = %v", err)
+	}
+	if err := reopened.WriteString("restart", "new value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if ttl, _ := reopened.TTL("restart"); ttl != memoria.NoExpiry {
+		t.Errorf("TTL() after Write = %v, want NoExpiry", ttl)
+	}
+	if err := reopened.SetExpiry("missing", time.Now()); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("SetExpiry() missing key error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestMemoriaExpirySweeper(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "memoria-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	m := memoria.New(memoria.Options{
+		Basedir:       tempDir,
+		MaxCacheSize:  1024,
+		SweepInterval: 10 * time.Millisecond,
+	})
+
+	if err := m.WriteWithTTL("expires", []byte("value"), 20*time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	if err := m.WriteString("stays", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries, err := os.ReadDir(tempDir)
+		if err != nil {
+			t.Fatalf("Failed to read Basedir: %v", err)
+		}
+		if len(entries) == 1 && entries[0].Name() == "stays" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper did not delete the expired key, Basedir has %d entries", len(entries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// Close can be called more than once
+	if err := m.Close(); err != nil {
+		t.Fatalf("second Close() error = %v", err)
+	}
+
+	// without a running sweeper expired keys are deleted on demand
+	if err := m.WriteWithTTL("expires", []byte("value"), time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n, err := m.DeleteExpired(); err != nil || n != 1 {
+		t.Errorf("DeleteExpired() = %d, %v, want 1", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "expires")); !os.IsNotExist(err) {
+		t.Errorf("expired key file still on disk")
+	}
+}
+
+func TestTTLOfLongKey(t *testing.T) {
+	dir := t.TempDir()
+	m := memoria.New(memoria.Options{Basedir: dir})
+
+	// the expiry file of a key with the longest allowed name still fits
+	key := strings.Repeat("k", 250)
+	if err := m.WriteString(key, "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !m.Has(key) {
+		t.Fatalf("Has() = false after Write")
+	}
+	if got, err := m.ReadString(key); err != nil || got != "value" {
+		t.Fatalf("Read() = %q, %v", got, err)
+	}
+
+	if err := m.WriteWithTTL(key, []byte("value"), time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n, err := m.DeleteExpired(); err != nil || n != 1 {
+		t.Errorf("DeleteExpired() = %d, %v, want 1", n, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read Basedir: %v", err)
+	}
+	for _, entry := range entries {
+		t.Errorf("%s left in Basedir after the key expired", entry.Name())
+	}
+}
+
+func TestExpiredKeysAreNotListed(t *testing.T) {
+	dir := t.TempDir()
+	m := memoria.New(memoria.Options{Basedir: dir})
+	if err := m.WriteWithTTL("expires", []byte("value"), time.Millisecond); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	if err := m.WriteWithTTL("later", []byte("value"), time.Hour); err != nil {
+		t.Fatalf("WriteWithTTL() error = %v", err)
+	}
+	if err := m.WriteString("stays", "value"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// keys are listed exactly when Has finds them
+	want := []string{"later", "stays"}
+	if got := collectKeys(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if m.Has("expires") {
+		t.Errorf("Has() = true for an expired key")
+	}
+
+	index := memoria.NewBTreeIndex()
+	memoria.New(memoria.Options{Basedir: dir, Index: index})
+	if got := index.Keys("", 10); !reflect.DeepEqual(got, want) {
+		t.Errorf("index has %v, want %v", got, want)
+	}
+}
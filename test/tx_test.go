@@ -0,0 +1,249 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestTxCommitAndIsolation(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024})
+	if err := m.WriteString("a", "old"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// cache the old value so uncommitted writes must not leak into the cache
+	if _, err := m.Read("a"); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	tx := m.Begin()
+	if err := tx.Put("a", []byte("new")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := tx.Put("b", []byte("created")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if got, _ := tx.Get("a"); string(got) != "new" {
+		t.Errorf("tx.Get(a) = %q, want the transaction's own write", got)
+	}
+	if got, _ := m.ReadString("a"); got != "old" {
+		t.Errorf("Read(a) before Commit = %q, want %q", got, "old")
+	}
+	if m.Has("b") {
+		t.Errorf("Has(b) = true before Commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got, _ := m.ReadString("a"); got != "new" {
+		t.Errorf("Read(a) after Commit = %q, want %q", got, "new")
+	}
+	if got, _ := m.ReadString("b"); got != "created" {
+		t.Errorf("Read(b) after Commit = %q, want %q", got, "created")
+	}
+	if err := tx.Commit(); !errors.Is(err, memoria.ErrTxDone) {
+		t.Errorf("second Commit() error = %v, want ErrTxDone", err)
+	}
+
+	tx = m.Begin()
+	tx.Erase("a")
+	if _, err := tx.Get("a"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Errorf("tx.Get() after tx.Erase() error = %v, want ErrKeyNotFound", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if !m.Has("a") {
+		t.Errorf("Has(a) = false after Rollback")
+	}
+}
+
+func TestTxConflict(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024})
+	if err := m.WriteString("a", "1"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// a key read by the transaction is written by someone else
+	tx := m.Begin()
+	if _, err := tx.Get("a"); err != nil {
+		t.Fatalf("tx.Get() error = %v", err)
+	}
+	if err := m.WriteString("a", "2"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	tx.Put("b", []byte("x"))
+	if err := tx.Commit(); !errors.Is(err, memoria.ErrTxConflict) {
+		t.Errorf("Commit() error = %v, want ErrTxConflict", err)
+	}
+	if m.Has("b") {
+		t.Errorf("conflicting transaction was applied")
+	}
+
+	// two transactions write the same key, the second to commit loses
+	tx1, tx2 := m.Begin(), m.Begin()
+	tx1.Put("a", []byte("tx1"))
+	tx2.Put("a", []byte("tx2"))
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1.Commit() error = %v", err)
+	}
+	if err := tx2.Commit(); !errors.Is(err, memoria.ErrTxConflict) {
+		t.Errorf("tx2.Commit() error = %v, want ErrTxConflict", err)
+	}
+
+	// a missing key that is created counts as modified
+	tx = m.Begin()
+	if _, err := tx.Get("c"); !errors.Is(err, memoria.ErrKeyNotFound) {
+		t.Fatalf("tx.Get() error = %v, want ErrKeyNotFound", err)
+	}
+	if err := m.WriteString("c", "created"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	tx.Put("c", []byte("tx"))
+	if err := tx.Commit(); !errors.Is(err, memoria.ErrTxConflict) {
+		t.Errorf("Commit() error = %v, want ErrTxConflict", err)
+	}
+}
+
+func TestTxConcurrentIncrements(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir(), MaxCacheSize: 1024})
+	if err := m.WriteString("counter", "0"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	const workers, increments = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; {
+				tx := m.Begin()
+				val, err := tx.Get("counter")
+				if err != nil {
+					t.Errorf("tx.Get() error = %v", err)
+					return
+				}
+				n, _ := strconv.Atoi(string(val))
+				tx.Put("counter", []byte(strconv.Itoa(n+1)))
+				err = tx.Commit()
+				if errors.Is(err, memoria.ErrTxConflict) {
+					continue // retry
+				}
+				if err != nil {
+					t.Errorf("Commit() error = %v", err)
+					return
+				}
+				j++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := m.ReadString("counter"); got != strconv.Itoa(workers*increments) {
+		t.Errorf("counter = %s, want %d", got, workers*increments)
+	}
+}
+
+// hookFS calls the hook set up before the next write to a file opened with OpenFile,
+// which only the write-ahead log is
+type hookFS struct {
+	memoria.FS
+	hook atomic.Pointer[func()]
+}
+
+func (h *hookFS) OpenFile(name string, flag int, perm os.FileMode) (memoria.File, error) {
+	f, err := h.FS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &hookFile{File: f, fs: h}, nil
+}
+
+type hookFile struct {
+	memoria.File
+	fs *hookFS
+}
+
+func (f *hookFile) Write(p []byte) (int, error) {
+	if hook := f.fs.hook.Swap(nil); hook != nil {
+		(*hook)()
+	}
+	return f.File.Write(p)
+}
+
+func TestTxConcurrentWrite(t *testing.T) {
+	fsys := &hookFS{FS: memoria.NewMemFS()}
+	m, err := memoria.Open(memoria.Options{Basedir: "store"}, memoria.WithFS(fsys), memoria.WithWAL(memoria.WALSyncNever))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer m.Close()
+	if err := m.WriteString("key", "old"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	tx := m.Begin()
+	if _, err := tx.Get("key"); err != nil {
+		t.Fatalf("tx.Get() error = %v", err)
+	}
+	tx.Put("key", []byte("tx"))
+
+	// a plain write is started once Commit has checked the versions and logs the batch
+	written := make(chan error, 1)
+	hook := func() {
+		go func() { written <- m.WriteString("key", "plain") }()
+		select {
+		case err := <-written:
+			written <- err
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	fsys.hook.Store(&hook)
+
+	err = tx.Commit()
+	if werr := <-written; werr != nil {
+		t.Fatalf("Write() error = %v", werr)
+	}
+	// either the commit conflicts or the plain write waits for it, it is never lost
+	if errors.Is(err, memoria.ErrTxConflict) {
+		return
+	}
+	if err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got, _ := m.ReadString("key"); got != "plain" {
+		t.Errorf("Read() = %q, want %q, the commit overwrote a write made after the check", got, "plain")
+	}
+}
+
+func TestTxDisjointKeysDoNotConflict(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: "store", FS: memoria.NewMemFS(), MaxCacheSize: 1024})
+	if err := m.WriteString("counter", "0"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// writes of other keys between Get and Commit never make a transaction conflict
+	for i := 0; i < 2000; i++ {
+		tx := m.Begin()
+		if _, err := tx.Get("counter"); err != nil {
+			t.Fatalf("tx.Get() error = %v", err)
+		}
+		if err := m.WriteString(fmt.Sprintf("other%d", i), "value"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		tx.Put("counter", []byte(strconv.Itoa(i)))
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() %d error = %v", i, err)
+		}
+	}
+}
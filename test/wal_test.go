@@ -0,0 +1,306 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+// openWALStore opens a store with a write-ahead log where keys starting with "sub"
+// are stored in the directory "sub". Creating a file named "sub" in Basedir makes
+// every write to those keys fail
+func openWALStore(t *testing.T, dir string) *memoria.Memoria {
+	t.Helper()
+	m, err := memoria.Open(memoria.Options{
+		MaxCacheSize: 1024,
+		PathTransform: func(key string) *memoria.PathKey {
+			if strings.HasPrefix(key, "sub") {
+				return &memoria.PathKey{Path: []string{"sub"}, FileName: key}
+			}
+			return &memoria.PathKey{Path: []string{}, FileName: key}
+		},
+	}, memoria.WithDir(dir), memoria.WithWAL(memoria.WALSyncAlways))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return m
+}
+
+func blockSubdir(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "sub"), []byte("x"), 0666); err != nil {
+		t.Fatalf("Failed to block sub directory: %v", err)
+	}
+}
+
+// crashingFS fails the rename of key into place and every write and sync of the log
+// after it, which stands in for a crash while a batch is applied
+type crashingFS struct {
+	*faultFS
+	key string
+}
+
+func (c *crashingFS) Rename(oldpath, newpath string) error {
+	if filepath.Base(newpath) == c.key {
+		c.fail(fault{op: "write", pattern: "wal.log", err: syscall.EIO})
+		c.fail(fault{op: "sync", pattern: "wal.log", err: syscall.EIO})
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EIO}
+	}
+	return c.faultFS.Rename(oldpath, newpath)
+}
+
+func openWALFaultStore(t *testing.T, fsys memoria.FS) *memoria.Memoria {
+	t.Helper()
+	m, err := memoria.Open(memoria.Options{Basedir: "store", MaxCacheSize: 1024},
+		memoria.WithFS(fsys), memoria.WithWAL(memoria.WALSyncAlways))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestWALReplaysInterruptedBatch(t *testing.T) {
+	fsys := newFaultFS()
+	crashed := openWALFaultStore(t, &crashingFS{faultFS: fsys, key: "b"})
+
+	b := &memoria.Batch{}
+	b.Put("a", []byte("1"))
+	b.Put("b", []byte("2"))
+	b.Put("c", []byte("3"))
+	if err := crashed.WriteBatch(b); err == nil {
+		t.Fatalf("WriteBatch() expected error")
+	}
+	if crashed.Has("c") {
+		t.Fatalf("batch was applied past the failing operation")
+	}
+	fsys.crash()
+	fsys.heal()
+
+	m := openWALFaultStore(t, fsys)
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		got, err := m.ReadString(key)
+		if err != nil || got != want {
+			t.Errorf("Read(%s) after replay = %q, %v, want %q", key, got, err, want)
+		}
+	}
+}
+
+func TestWALDiscardsTornBatch(t *testing.T) {
+	fsys := newFaultFS()
+	crashed := openWALFaultStore(t, &crashingFS{faultFS: fsys, key: "b"})
+
+	b := &memoria.Batch{}
+	b.Put("b", []byte("1"))
+	b.Put("a", []byte("2"))
+	if err := crashed.WriteBatch(b); err == nil {
+		t.Fatalf("WriteBatch() expected error")
+	}
+	fsys.crash()
+	fsys.heal()
+
+	// cut the batch record short as if the crash happened while it was logged
+	logPath := filepath.Join("store", ".memoria-wal", "wal.log")
+	info, err := fsys.Stat(logPath)
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	f, err := fsys.OpenFile(logPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	if err := f.Truncate(info.Size() - 3); err != nil {
+		t.Fatalf("Failed to truncate log: %v", err)
+	}
+	f.Close()
+
+	m := openWALFaultStore(t, fsys)
+	if m.Has("b") || m.Has("a") {
+		t.Errorf("torn batch was applied")
+	}
+}
+
+func TestWALAbortsFailedBatch(t *testing.T) {
+	dir := t.TempDir()
+	blockSubdir(t, dir)
+	m := openWALStore(t, dir)
+
+	b := &memoria.Batch{}
+	b.Put("a", []byte("first"))
+	b.Put("subkey", []byte("x"))
+	if err := m.WriteBatch(b); err == nil {
+		t.Fatalf("WriteBatch() expected error")
+	}
+	pairs := map[string][]byte{"b": []byte("first"), "subkey": []byte("x")}
+	if results := m.BulkWrite(pairs, 1); results[1].Error == nil {
+		t.Fatalf("BulkWrite(subkey) expected error")
+	}
+
+	// the failed batches are no longer pending so the log is still truncated
+	if err := m.WriteString("a", "newer"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := m.WriteString("b", "newer"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		b := &memoria.Batch{}
+		b.Put("c", []byte(strings.Repeat("v", 1024)))
+		if err := m.WriteBatch(b); err != nil {
+			t.Fatalf("WriteBatch() error = %v", err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, ".memoria-wal", "wal.log"))
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("log has %d bytes after all batches were committed or aborted", info.Size())
+	}
+	m.Close()
+
+	// Open does not apply the failed batches over the writes made after them
+	if err := os.Remove(filepath.Join(dir, "sub")); err != nil {
+		t.Fatalf("Failed to unblock sub directory: %v", err)
+	}
+	m = openWALStore(t, dir)
+	defer m.Close()
+	for _, key := range []string{"a", "b"} {
+		if got, err := m.ReadString(key); err != nil || got != "newer" {
+			t.Errorf("Read(%s) after reopening = %q, %v, want %q", key, got, err, "newer")
+		}
+	}
+	if m.Has("subkey") {
+		t.Errorf("Has(subkey) = true, the failed batches were applied by Open")
+	}
+}
+
+func TestWALBulkWriteAndErase(t *testing.T) {
+	dir := t.TempDir()
+	m := openWALStore(t, dir)
+	defer m.Close()
+
+	pairs := map[string][]byte{"a": []byte("1"), "b": []byte("2"), "subkey": []byte("3")}
+	for _, result := range m.BulkWrite(pairs, 2) {
+		if result.Error != nil {
+			t.Errorf("BulkWrite(%s) error = %v", result.Key, result.Error)
+		}
+	}
+
+	b := &memoria.Batch{}
+	b.Erase("a")
+	b.Erase("missing")
+	b.Put("b", []byte("updated"))
+	if err := m.WriteBatch(b); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+
+	if m.Has("a") {
+		t.Errorf("Has(a) = true after erase in batch")
+	}
+	if got, _ := m.ReadString("b"); got != "updated" {
+		t.Errorf("Read(b) = %q, want %q", got, "updated")
+	}
+
+	// committed batches do not stay in the log
+	info, err := os.Stat(filepath.Join(dir, ".memoria-wal", "wal.log"))
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("log has %d bytes after all batches were committed", info.Size())
+	}
+
+	// the log survives EraseAll and is not listed as a key
+	if err := m.EraseAll(); err != nil {
+		t.Fatalf("EraseAll() error = %v", err)
+	}
+	for key := range m.Keys(nil) {
+		t.Errorf("Keys() returned %s after EraseAll", key)
+	}
+	if err := m.WriteBatch(b); err != nil {
+		t.Errorf("WriteBatch() after EraseAll error = %v", err)
+	}
+}
+
+// stuckFS holds the first write to the first temp file created once armed until release
+// is closed
+type stuckFS struct {
+	*faultFS
+	armed   atomic.Bool
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (s *stuckFS) CreateTemp(dir, pattern string, perm os.FileMode) (memoria.File, error) {
+	f, err := s.faultFS.CreateTemp(dir, pattern, perm)
+	if err != nil || !s.armed.CompareAndSwap(true, false) {
+		return f, err
+	}
+	return &stuckFile{File: f, fs: s}, nil
+}
+
+type stuckFile struct {
+	memoria.File
+	fs   *stuckFS
+	once sync.Once
+}
+
+func (f *stuckFile) Write(p []byte) (int, error) {
+	f.once.Do(func() {
+		close(f.fs.stalled)
+		<-f.fs.release
+	})
+	return f.File.Write(p)
+}
+
+func TestWALCompactsWhileBatchesArePending(t *testing.T) {
+	fsys := newFaultFS()
+	stuck := &stuckFS{faultFS: fsys, stalled: make(chan struct{}), release: make(chan struct{})}
+	m := openWALFaultStore(t, stuck)
+	stuck.armed.Store(true)
+
+	held := make(chan error, 1)
+	go func() {
+		b := &memoria.Batch{}
+		b.Put("stuck", []byte("held"))
+		held <- m.WriteBatch(b)
+	}()
+	<-stuck.stalled
+	defer func() {
+		close(stuck.release)
+		<-held
+	}()
+
+	// the held batch keeps the log from being truncated, so it is compacted instead
+	val := strings.Repeat("v", 256<<10)
+	for i := 0; i < 40; i++ {
+		b := &memoria.Batch{}
+		b.Put("key", []byte(val))
+		if err := m.WriteBatch(b); err != nil {
+			t.Fatalf("WriteBatch() error = %v", err)
+		}
+	}
+	info, err := fsys.Stat(filepath.Join("store", ".memoria-wal", "wal.log"))
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if info.Size() > 5<<20 {
+		t.Errorf("log has %d bytes with one small batch pending", info.Size())
+	}
+
+	// the compacted log still holds the pending batch
+	fsys.crash()
+	reopened := openWALFaultStore(t, fsys)
+	for key, want := range map[string]string{"stuck": "held", "key": val} {
+		if got, err := reopened.ReadString(key); err != nil || got != want {
+			t.Errorf("Read(%s) after replay = %d bytes, %v, want %d", key, len(got), err, len(want))
+		}
+	}
+}
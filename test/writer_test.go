@@ -0,0 +1,124 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	memoria "github.com/IMGIITRoorkee/Memoria_Simple"
+)
+
+func TestCreatePublishesOnClose(t *testing.T) {
+	for _, compression := range []memoria.Compression{nil, memoria.NewGzipCompression()} {
+		t.Run(fmt.Sprintf("compression %v", compression != nil), func(t *testing.T) {
+			m := memoria.New(memoria.Options{Basedir: t.TempDir(), Compression: compression})
+			if err := m.Write("key", []byte("old")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			w, err := m.Create("key")
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				if _, err := fmt.Fprintf(w, "part %d;", i); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			if val, err := m.Read("key"); err != nil || string(val) != "old" {
+				t.Errorf("Read() before Close = %q, %v, want the old value", val, err)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if val, err := m.Read("key"); err != nil || string(val) != "part 0;part 1;part 2;" {
+				t.Errorf("Read() after Close = %q, %v", val, err)
+			}
+
+			if _, err := w.Write([]byte("late")); !errors.Is(err, memoria.ErrWriterClosed) {
+				t.Errorf("Write() after Close error = %v, want ErrWriterClosed", err)
+			}
+			if err := w.Close(); !errors.Is(err, memoria.ErrWriterClosed) {
+				t.Errorf("second Close() error = %v, want ErrWriterClosed", err)
+			}
+			if err := w.Abort(); err != nil {
+				t.Errorf("Abort() after Close error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateAbort(t *testing.T) {
+	dir := t.TempDir()
+	m := memoria.New(memoria.Options{Basedir: dir})
+
+	w, err := m.Create("key")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	w.Write([]byte("discarded"))
+	if err := w.Abort(); err != nil {
+		t.Fatalf("Abort() error = %v", err)
+	}
+
+	if m.Has("key") {
+		t.Errorf("Has() = true after Abort")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Basedir holds %v after Abort, want no temp files", entries)
+	}
+}
+
+func TestCreateLocksOnlyItsKey(t *testing.T) {
+	m := memoria.New(memoria.Options{Basedir: t.TempDir()})
+
+	w, err := m.Create("slow")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer w.Abort()
+
+	// other keys are written and read while the writer is open
+	done := make(chan error, 1)
+	go func() {
+		if err := m.Write("other", []byte("value")); err != nil {
+			done <- err
+			return
+		}
+		_, err := m.Read("other")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("writing another key blocked on the open writer")
+	}
+
+	// writes to the same key wait for the writer
+	written := make(chan error, 1)
+	go func() { written <- m.Write("slow", []byte("second")) }()
+	select {
+	case <-written:
+		t.Fatalf("Write() of the same key did not wait for the open writer")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w.Write([]byte("first"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if val, err := m.Read("slow"); err != nil || string(val) != "second" {
+		t.Errorf("Read() = %q, %v, want the later write", val, err)
+	}
+}
@@ -0,0 +1,314 @@
+package memoria
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// The reasons an InvalidKeyError gives for rejecting a key
+var (
+	ErrAbsolutePath  = errors.New("absolute path")
+	ErrPathTraversal = errors.New("path traversal")
+	ErrEmptySegment  = errors.New("empty path segment")
+	ErrNULByte       = errors.New("NUL byte in path")
+	ErrNameTooLong   = errors.New("name too long")
+	ErrReservedName  = errors.New("name reserved for internal files")
+)
+
+// ErrInvalidKey matches every InvalidKeyError with errors.Is
+var ErrInvalidKey = errors.New("invalid key")
+
+// InvalidKeyError is returned for keys whose PathKey would not name a file inside Basedir
+type InvalidKeyError struct {
+	Key     string
+	Segment string // the part of the PathKey which was rejected
+	Err     error  // one of the reasons above
+}
+
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("%s %q: %s %q", ErrInvalidKey, e.Key, e.Err, e.Segment)
+}
+
+func (e *InvalidKeyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *InvalidKeyError) Is(target error) bool {
+	return target == ErrInvalidKey
+}
+
+const (
+	// maxNameLength is the longest file name most filesystems allow
+	maxNameLength = 255
+
+	blobDirName   = internalPrefix + "blobs"
+	blobRefPrefix = "sha256:"
+	// blobRefSize is the size of a reference to a blob, the prefix and a hex digest
+	blobRefSize = len(blobRefPrefix) + 2*sha256.Size
+)
+
+// ShardedTransform returns a PathTransform which spreads keys over depth levels of
+// directories named after consecutive width character slices of the key. With a width
+// and depth of 2 "abcdef" is stored in ab/cd/abcdef. Keys too short for every level use
+// as many full slices as they have. The key is kept as the file name so the returned
+// InversePathTransform only has to read it back
+func ShardedTransform(width, depth int) (PathTransform, InversePathTransform) {
+	transform := func(key string) *PathKey {
+		return &PathKey{Path: shard(key, width, depth), FileName: key}
+	}
+	return transform, fileNameInverseTransform
+}
+
+// HashedTransform returns a PathTransform which spreads keys over depth levels of
+// directories named after width character slices of the hex SHA-256 digest of the key,
+// so keys with common prefixes are still spread evenly. The key is kept as the file
+// name, which indexes the digest directories back to the keys, and the returned
+// InversePathTransform reads it back
+func HashedTransform(width, depth int) (PathTransform, InversePathTransform) {
+	transform := func(key string) *PathKey {
+		sum := sha256.Sum256([]byte(key))
+		return &PathKey{Path: shard(hex.EncodeToString(sum[:]), width, depth), FileName: key}
+	}
+	return transform, fileNameInverseTransform
+}
+
+func fileNameInverseTransform(pathKey *PathKey) string {
+	return pathKey.FileName
+}
+
+// shard splits up to depth slices of width characters off the front of s
+func shard(s string, width, depth int) []string {
+	path := []string{}
+	if width <= 0 {
+		return path
+	}
+	for i := 0; i < depth && (i+1)*width <= len(s); i++ {
+		path = append(path, s[i*width:(i+1)*width])
+	}
+	return path
+}
+
+// validatePathKey checks that every segment of the PathKey names a single file or
+// directory below Basedir which is not one of the store's internal files
+func validatePathKey(key string, pathKey *PathKey) error {
+	if pathKey == nil {
+		return &InvalidKeyError{Key: key, Err: ErrEmptySegment}
+	}
+	segments := append(append([]string{}, pathKey.Path...), pathKey.FileName)
+	for i, segment := range segments {
+		var err error
+		switch {
+		case segment == "":
+			err = ErrEmptySegment
+		case strings.IndexByte(segment, 0) >= 0:
+			err = ErrNULByte
+		case i == 0 && (filepath.IsAbs(segment) || strings.HasPrefix(segment, "/") || filepath.VolumeName(segment) != ""):
+			err = ErrAbsolutePath
+		case segment == "." || segment == ".." || strings.ContainsAny(segment, `/`+string(filepath.Separator)):
+			err = ErrPathTraversal
+		case len(segment) > maxNameLength:
+			err = ErrNameTooLong
+		case isInternalFile(segment):
+			err = ErrReservedName
+		}
+		if err != nil {
+			return &InvalidKeyError{Key: key, Segment: segment, Err: err}
+		}
+	}
+	return nil
+}
+
+// EscapedTransform returns a PathTransform which stores arbitrary binary keys. Bytes
+// other than letters, digits, '-', '_' and a '.' which does not start a name are
+// escaped as %XX, and names longer than a filesystem allows are split over directories
+// whose names end in '%'. The returned InversePathTransform decodes the names back
+func EscapedTransform() (PathTransform, InversePathTransform) {
+	return escapedTransform, escapedInverseTransform
+}
+
+func escapedTransform(key string) *PathKey {
+	const hexDigits = "0123456789ABCDEF"
+	pathKey := &PathKey{Path: []string{}}
+	name := []byte{}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		unit := []byte{c}
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' && len(name) > 0) {
+			unit = []byte{'%', hexDigits[c>>4], hexDigits[c&15]}
+		}
+		// a trailing '%' is never part of an escape so directories never clash with files
+		if len(name)+len(unit) >= maxNameLength {
+			pathKey.Path = append(pathKey.Path, string(name)+"%")
+			name = name[:0]
+			if c == '.' {
+				unit = []byte("%2E")
+			}
+		}
+		name = append(name, unit...)
+	}
+	pathKey.FileName = string(name)
+	return pathKey
+}
+
+func escapedInverseTransform(pathKey *PathKey) string {
+	escaped := ""
+	for _, dir := range pathKey.Path {
+		escaped += strings.TrimSuffix(dir, "%")
+	}
+	escaped += pathKey.FileName
+
+	key := make([]byte, 0, len(escaped))
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] == '%' && i+2 < len(escaped) {
+			if c, err := hex.DecodeString(escaped[i+1 : i+3]); err == nil {
+				key = append(key, c[0])
+				i += 2
+				continue
+			}
+		}
+		key = append(key, escaped[i])
+	}
+	return string(key)
+}
+
+// blobPath returns where the blob with the given hex digest is stored
+func (m *Memoria) blobPath(digest string) string {
+	return filepath.Join(append(append([]string{m.Basedir, blobDirName}, shard(digest, 2, 2)...), digest)...)
+}
+
+// storeBlob moves the value written to tmp into the blob store unless a blob with the
+// same digest already exists, and returns a new temp file referencing the blob. The
+// reference is left open so the caller can sync it
+func (m *Memoria) storeBlob(pathKey *PathKey, tmp string, digest string) (File, error) {
+	blob := m.blobPath(digest)
+	if _, err := m.FS.Stat(blob); err == nil {
+		m.FS.Remove(tmp) // the value is already stored
+	} else {
+		if err := m.FS.MkdirAll(filepath.Dir(blob), m.pathPerm); err != nil {
+			m.FS.Remove(tmp)
+			return nil, err
+		}
+		if err := m.FS.Rename(tmp, blob); err != nil {
+			m.FS.Remove(tmp)
+			return nil, err
+		}
+	}
+
+	ref, err := m.createKeyFile(pathKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(ref, blobRefPrefix+digest); err != nil {
+		return nil, cleanUp(m.FS, ref, err)
+	}
+	return ref, nil
+}
+
+// openValue opens the file holding the value of the key
+func (m *Memoria) openValue(pathKey *PathKey) (File, error) {
+	return m.openKeyFile(m.completePath(pathKey))
+}
+
+// valueFile returns the file holding the value of the key file at path. This is the
+// key file itself unless the store is content addressed
+func (m *Memoria) valueFile(path string) (string, error) {
+	if !m.ContentAddressed {
+		return path, nil
+	}
+	digest, err := readBlobRef(m.FS, path)
+	if err != nil {
+		return "", err
+	}
+	return m.blobPath(digest), nil
+}
+
+// missingBlob reports a blob which cannot be found as corruption of the key file at
+// path, which still references it
+func missingBlob(err error, path string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s references a missing blob", ErrCorrupt, path)
+	}
+	return err
+}
+
+// readBlobRef returns the digest referenced by the key file at path
+func readBlobRef(fsys FS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ref := make([]byte, blobRefSize+1)
+	n, err := io.ReadFull(f, ref)
+	if err != io.ErrUnexpectedEOF || n != blobRefSize || !strings.HasPrefix(string(ref[:n]), blobRefPrefix) {
+		return "", fmt.Errorf("%w: %s is not a blob reference", ErrCorrupt, path)
+	}
+	digest := string(ref[len(blobRefPrefix):n])
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", fmt.Errorf("%w: %s is not a blob reference", ErrCorrupt, path)
+	}
+	return digest, nil
+}
+
+// CollectGarbage removes the blobs of a content addressed store which are no longer
+// referenced by any key, and returns how many were removed. Erasing or overwriting a
+// key never removes its blob since other keys may share it
+func (m *Memoria) CollectGarbage() (int, error) {
+	if !m.ContentAddressed {
+		return 0, nil
+	}
+	if err := m.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	referenced := make(map[string]bool)
+	var refErr error
+	err := m.walkPaths(func(key, path string) bool {
+		digest, err := readBlobRef(m.FS, path)
+		if err != nil {
+			refErr = err
+			return false
+		}
+		referenced[digest] = true
+		return true
+	})
+	if refErr != nil {
+		// removing blobs without knowing every reference could lose values
+		return 0, fmt.Errorf("cannot read references: %s", refErr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot list keys: %s", err)
+	}
+
+	removed := 0
+	blobDir := filepath.Join(m.Basedir, blobDirName)
+	err = walkDir(m.FS, blobDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == blobDir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		// blobs whose reference is about to be published are not referenced yet
+		if d.IsDir() || referenced[d.Name()] || isInternalFile(d.Name()) || m.inUse(path) {
+			return nil
+		}
+		if err := m.FS.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		m.pruneDirs(filepath.Dir(path))
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,338 @@
+package memoria
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NoExpiry is returned by TTL for keys which never expire
+const NoExpiry time.Duration = -1
+
+// ttlFilePrefix is the prefix of the file next to a value which holds its expiry. The
+// prefix is followed by the hex SHA-256 digest of the value's file name, so the name fits
+// however long the value's is, and the file holds the expiry and then the file name
+const ttlFilePrefix = ".memoria-ttl-"
+
+// sweepBatchSize is the number of expired keys deleted per acquisition of the store's mutex
+const sweepBatchSize = 128
+
+// WriteWithTTL writes the key-value pair like Write. Once ttl has passed the key is
+// treated as missing and deleted by the sweeper
+func (m *Memoria) WriteWithTTL(key string, val []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %s", ttl)
+	}
+	return m.writeStream(key, bytes.NewReader(val), false, false, time.Now().Add(ttl))
+}
+
+// SetExpiry sets the time at which an existing key expires. A zero time removes the
+// expiry so the key is kept forever
+func (m *Memoria) SetExpiry(key string, expiresAt time.Time) error {
+	if len(key) <= 0 {
+		return fmt.Errorf("Empty key")
+	}
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := m.lockWrite(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.liveExpiry(pathKey); err != nil {
+		return err
+	}
+
+	if expiresAt.IsZero() {
+		if err := m.removeExpiry(pathKey); err != nil {
+			return fmt.Errorf("Cannot remove expiry: %s", err)
+		}
+	} else if err := m.writeExpiry(pathKey, expiresAt); err != nil {
+		return fmt.Errorf("Cannot write expiry: %s", err)
+	}
+
+	m.setExpiry(key, expiresAt)
+	return nil
+}
+
+// TTL returns how long the key has left before it expires, or NoExpiry if it never does
+func (m *Memoria) TTL(key string) (time.Duration, error) {
+	if len(key) <= 0 {
+		return 0, fmt.Errorf("Empty key")
+	}
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	expiresAt, err := m.liveExpiry(pathKey)
+	if err != nil {
+		return 0, err
+	}
+	if expiresAt.IsZero() {
+		return NoExpiry, nil
+	}
+	return time.Until(expiresAt), nil
+}
+
+// DeleteExpired walks Basedir and erases every expired key. It returns the number of
+// keys erased. Keys are only locked while they are erased
+func (m *Memoria) DeleteExpired() (int, error) {
+	if err := m.checkWritable(); err != nil {
+		return 0, err
+	}
+	base := filepath.Clean(m.Basedir)
+	batch := make([]string, 0, sweepBatchSize)
+	deleted := 0
+
+	err := walkDir(m.FS, base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasPrefix(d.Name(), ttlFilePrefix) {
+			return nil
+		}
+
+		expiresAt, name, err := parseExpiry(m.FS, path)
+		if err != nil || time.Now().Before(expiresAt) {
+			return err
+		}
+
+		rel, err := filepath.Rel(base, filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			return err
+		}
+		batch = append(batch, m.InverseTransform(pathKeyFor(rel)))
+		if len(batch) == sweepBatchSize {
+			deleted += m.eraseExpired(batch)
+			batch = batch[:0]
+		}
+		return nil
+	})
+
+	deleted += m.eraseExpired(batch)
+	return deleted, err
+}
+
+// eraseExpired erases the keys which are still expired once they are locked, they
+// may have been written again since the sweeper saw them
+func (m *Memoria) eraseExpired(keys []string) int {
+	deleted := 0
+	for _, key := range keys {
+		if m.eraseIfExpired(key) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// eraseIfExpired erases the key if it is expired and reports whether it did
+func (m *Memoria) eraseIfExpired(key string) bool {
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return false
+	}
+	unlock, err := m.lockWrite(key)
+	if err != nil {
+		return false
+	}
+	defer unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt, err := m.readExpiry(pathKey)
+	if err != nil || expiresAt.IsZero() || time.Now().Before(expiresAt) {
+		return false
+	}
+	return m.eraseWithLock(key) == nil
+}
+
+func (m *Memoria) startSweeper() {
+	m.stopSweeper = make(chan struct{})
+	m.sweeperDone = make(chan struct{})
+
+	go func() {
+		defer close(m.sweeperDone)
+		ticker := time.NewTicker(m.SweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.DeleteExpired() // errors are retried on the next tick
+			case <-m.stopSweeper:
+				return
+			}
+		}
+	}()
+}
+
+// stopSweeping stops the sweeper and waits for it to finish its current sweep
+func (m *Memoria) stopSweeping() {
+	if m.stopSweeper == nil {
+		return
+	}
+	close(m.stopSweeper)
+	<-m.sweeperDone
+}
+
+// liveExpiry returns the expiry of an existing key or ErrKeyNotFound if the key is
+// missing or expired
+func (m *Memoria) liveExpiry(pathKey *PathKey) (time.Time, error) {
+	info, err := m.FS.Stat(m.completePath(pathKey))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return time.Time{}, fmt.Errorf("%w: %s", ErrKeyNotFound, pathKey.originalKey)
+		}
+		return time.Time{}, fmt.Errorf("Cannot stat file: %s", err)
+	}
+	if !info.Mode().IsRegular() {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrKeyNotFound, pathKey.originalKey)
+	}
+
+	expiresAt, err := m.readExpiry(pathKey)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Cannot read expiry: %s", err)
+	}
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrKeyNotFound, pathKey.originalKey)
+	}
+	return expiresAt, nil
+}
+
+func (m *Memoria) expiryPath(pathKey *PathKey) string {
+	return filepath.Join(m.pathFor(pathKey), expiryFileName(pathKey.FileName))
+}
+
+// expiryFileName returns the name of the expiry file of the value named name
+func expiryFileName(name string) string {
+	digest := sha256.Sum256([]byte(name))
+	return ttlFilePrefix + hex.EncodeToString(digest[:])
+}
+
+// expiredFile reports whether the value file at path has an expiry which passed by now.
+// Expiries which cannot be read are left to the reads of the key to report
+func (m *Memoria) expiredFile(path string, now time.Time) bool {
+	expiryPath := filepath.Join(filepath.Dir(path), expiryFileName(filepath.Base(path)))
+	expiresAt, _, err := parseExpiry(m.FS, expiryPath)
+	return err == nil && !now.Before(expiresAt)
+}
+
+// readExpiry returns the expiry stored next to the value, or the zero time if it has none
+func (m *Memoria) readExpiry(pathKey *PathKey) (time.Time, error) {
+	expiresAt, _, err := parseExpiry(m.FS, m.expiryPath(pathKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	return expiresAt, err
+}
+
+// writeExpiry atomically replaces the expiry stored next to the value
+func (m *Memoria) writeExpiry(pathKey *PathKey, expiresAt time.Time) error {
+	tmp, err := m.stageExpiry(pathKey, expiresAt)
+	if err != nil {
+		return err
+	}
+	if err := m.FS.Rename(tmp, m.expiryPath(pathKey)); err != nil {
+		m.FS.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// stageExpiry writes the expiry to a temp file which is renamed over the expiry file of
+// the key, and returns its name
+func (m *Memoria) stageExpiry(pathKey *PathKey, expiresAt time.Time) (string, error) {
+	if err := m.createDirIfMissing(pathKey); err != nil {
+		return "", err
+	}
+	f, err := m.createKeyFile(pathKey)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(f, strconv.FormatInt(expiresAt.UnixNano(), 10)+"\n"+pathKey.FileName); err != nil {
+		return "", cleanUp(m.FS, f, err)
+	}
+	if err := f.Close(); err != nil {
+		m.FS.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// removeExpiry removes the expiry stored next to the value, if any
+func (m *Memoria) removeExpiry(pathKey *PathKey) error {
+	if err := m.FS.Remove(m.expiryPath(pathKey)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// parseExpiry returns the expiry in the expiry file at path and the file name of its value
+func parseExpiry(fsys FS, path string) (time.Time, string, error) {
+	data, err := readFile(fsys, path)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	expiry, name, _ := strings.Cut(string(data), "\n")
+	nanos, err := strconv.ParseInt(strings.TrimSpace(expiry), 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid expiry in %s: %s", path, err)
+	}
+	if expiryFileName(name) != filepath.Base(path) {
+		return time.Time{}, "", fmt.Errorf("invalid expiry in %s: not the expiry of %q", path, name)
+	}
+	return time.Unix(0, nanos), name, nil
+}
+
+// expired reports whether the in-memory expiry of the key has passed
+func (m *Memoria) expired(key string) bool {
+	m.expiryMu.Lock()
+	defer m.expiryMu.Unlock()
+
+	expiresAt, ok := m.expiry[key]
+	return ok && !time.Now().Before(expiresAt)
+}
+
+// setExpiry records the expiry of the key in memory, a zero time forgets it
+func (m *Memoria) setExpiry(key string, expiresAt time.Time) {
+	m.expiryMu.Lock()
+	defer m.expiryMu.Unlock()
+
+	if expiresAt.IsZero() {
+		delete(m.expiry, key)
+		return
+	}
+	m.expiry[key] = expiresAt
+}
+
+func (m *Memoria) clearExpiries() {
+	m.expiryMu.Lock()
+	defer m.expiryMu.Unlock()
+
+	for key := range m.expiry {
+		delete(m.expiry, key)
+	}
+}
@@ -0,0 +1,215 @@
+package memoria
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTxConflict is returned by Commit when a key the transaction read or wrote was
+	// modified by someone else since
+	ErrTxConflict = errors.New("transaction conflict")
+	// ErrTxDone is returned when a transaction is used after Commit or Rollback
+	ErrTxDone = errors.New("transaction has already been committed or rolled back")
+)
+
+// Tx is a read-modify-write transaction. Writes are buffered in the transaction and
+// stay invisible to other readers until Commit. Conflicts are detected optimistically
+// at Commit by comparing the versions of the keys the transaction used. A Tx must not
+// be used from several goroutines at once, and must end with Commit or Rollback so the
+// store stops tracking the versions of its keys
+type Tx struct {
+	m        *Memoria
+	versions map[string]uint64  // version of every key when the transaction first used it
+	writes   map[string]batchOp // the last write to every key
+	order    []string           // keys in the order they were first written
+	done     bool
+}
+
+// Begin starts a transaction
+func (m *Memoria) Begin() *Tx {
+	return &Tx{
+		m:        m,
+		versions: make(map[string]uint64),
+		writes:   make(map[string]batchOp),
+	}
+}
+
+// Get returns the value of the key as seen by the transaction, including its own
+// uncommitted writes
+func (tx *Tx) Get(key string) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if op, ok := tx.writes[key]; ok {
+		if op.kind == walOpErase {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		return append([]byte(nil), op.val...), nil
+	}
+
+	// the version is taken before the read, a write in between makes Commit fail
+	tx.track(key)
+	return tx.m.Read(key)
+}
+
+// Put buffers a write of val to key until Commit
+func (tx *Tx) Put(key string, val []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if len(key) <= 0 {
+		return fmt.Errorf("Empty key")
+	}
+	tx.write(batchOp{kind: walOpPut, key: key, val: append([]byte(nil), val...)})
+	return nil
+}
+
+// Erase buffers an erase of key until Commit. Erasing a missing key is not an error
+func (tx *Tx) Erase(key string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if len(key) <= 0 {
+		return fmt.Errorf("Empty key")
+	}
+	tx.write(batchOp{kind: walOpErase, key: key})
+	return nil
+}
+
+// Commit applies the writes of the transaction as one batch. It returns ErrTxConflict
+// without applying anything if any key the transaction used was modified since
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.release()
+
+	m := tx.m
+	if len(tx.order) == 0 {
+		return tx.check()
+	}
+
+	// every key used stays locked from the check until the writes are applied, so no
+	// other write can land in between and be overwritten
+	keys := make([]string, 0, len(tx.versions))
+	for key := range tx.versions {
+		keys = append(keys, key)
+	}
+	unlock, err := m.lockWrites(keys)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := tx.check(); err != nil {
+		return err
+	}
+	b := &Batch{}
+	for _, key := range tx.order {
+		b.ops = append(b.ops, tx.writes[key])
+	}
+	return m.writeBatch(b, true)
+}
+
+// Rollback discards the writes of the transaction
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.release()
+	tx.writes = nil
+	tx.order = nil
+	return nil
+}
+
+// check returns ErrTxConflict if any key the transaction used was modified since
+func (tx *Tx) check() error {
+	for key, version := range tx.versions {
+		if tx.m.version(key) != version {
+			return fmt.Errorf("%w: %s", ErrTxConflict, key)
+		}
+	}
+	return nil
+}
+
+func (tx *Tx) write(op batchOp) {
+	tx.track(op.key)
+	if _, ok := tx.writes[op.key]; !ok {
+		tx.order = append(tx.order, op.key)
+	}
+	tx.writes[op.key] = op
+}
+
+// track records the version of the key the first time the transaction uses it
+func (tx *Tx) track(key string) {
+	if _, ok := tx.versions[key]; !ok {
+		tx.versions[key] = tx.m.watch(key)
+	}
+}
+
+// release stops watching the keys the transaction used
+func (tx *Tx) release() {
+	for key := range tx.versions {
+		tx.m.unwatch(key)
+	}
+}
+
+// keyVersion is the version of a watched key
+type keyVersion struct {
+	version  uint64
+	watchers int
+}
+
+// watch starts tracking the version of the key and returns it. Only watched keys have
+// a version, so the versions kept grow with the keys in use by transactions and reads
+// rather than with every key written. Every watch is paired with unwatch
+func (m *Memoria) watch(key string) uint64 {
+	m.versionMu.Lock()
+	defer m.versionMu.Unlock()
+	v, ok := m.versions[key]
+	if !ok {
+		v = &keyVersion{}
+		m.versions[key] = v
+	}
+	v.watchers++
+	return max(v.version, m.eraseAllSeq)
+}
+
+// unwatch stops tracking the version of the key once nothing else watches it
+func (m *Memoria) unwatch(key string) {
+	m.versionMu.Lock()
+	defer m.versionMu.Unlock()
+	if v, ok := m.versions[key]; ok {
+		if v.watchers--; v.watchers == 0 {
+			delete(m.versions, key)
+		}
+	}
+}
+
+// version returns the version of the key, which changes on every write or erase. The
+// caller must be watching the key
+func (m *Memoria) version(key string) uint64 {
+	m.versionMu.Lock()
+	defer m.versionMu.Unlock()
+	return max(m.versions[key].version, m.eraseAllSeq)
+}
+
+func (m *Memoria) bumpVersion(key string) {
+	m.versionMu.Lock()
+	defer m.versionMu.Unlock()
+	m.versionSeq++
+	if v, ok := m.versions[key]; ok {
+		v.version = m.versionSeq
+	}
+}
+
+// bumpAllVersions changes the version of every key at once
+func (m *Memoria) bumpAllVersions() {
+	m.versionMu.Lock()
+	defer m.versionMu.Unlock()
+	m.versionSeq++
+	m.eraseAllSeq = m.versionSeq
+}
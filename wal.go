@@ -0,0 +1,541 @@
+package memoria
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WALSyncPolicy decides when the write-ahead log is flushed to disk
+type WALSyncPolicy int
+
+const (
+	// WALSyncAlways flushes every batch before it is applied and writes the batch
+	// with sync, so an acknowledged batch survives a power loss
+	WALSyncAlways WALSyncPolicy = iota
+	// WALSyncPeriodic flushes the log every WALSyncPeriod. A process crash never
+	// applies part of a batch, but the values are not synced either, so a power loss
+	// may lose the batches of the last period and leave some of them partly applied
+	WALSyncPeriodic
+	// WALSyncNever leaves flushing to the operating system
+	WALSyncNever
+)
+
+const (
+	walDirName           = internalPrefix + "wal"
+	walFileName          = "wal.log"
+	defaultWALSyncPeriod = time.Second
+	// walCompactSize is the size from which the log is compacted when batches finish
+	// while others are still pending, so it cannot grow without bound under load
+	walCompactSize = 4 << 20
+
+	walRecordBatch  byte = 1
+	walRecordCommit byte = 2
+	walRecordAbort  byte = 3
+
+	walOpPut   byte = 0
+	walOpErase byte = 1
+)
+
+// crcTable is the CRC-32C table used to checksum log records and snapshots
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Batch is a list of puts and erases applied together by WriteBatch
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	kind byte
+	key  string
+	val  []byte
+}
+
+// Put adds a write of val to key to the batch
+func (b *Batch) Put(key string, val []byte) {
+	b.ops = append(b.ops, batchOp{kind: walOpPut, key: key, val: val})
+}
+
+// Erase adds an erase of key to the batch. Erasing a missing key is not an error
+func (b *Batch) Erase(key string) {
+	b.ops = append(b.ops, batchOp{kind: walOpErase, key: key})
+}
+
+// Len returns the number of operations in the batch
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// WriteBatch applies every operation of the batch in order. With a write-ahead log
+// the batch is logged first, so after a crash it is either fully applied or not at all.
+// A batch which fails without a crash is aborted in the log, the operations applied
+// before the failure stay applied and Open never applies the batch again
+func (m *Memoria) WriteBatch(b *Batch) error {
+	return m.writeBatch(b, false)
+}
+
+// writeBatch is WriteBatch, keysLocked tells whether the caller has locked every key of
+// the batch with lockWrite
+func (m *Memoria) writeBatch(b *Batch, keysLocked bool) error {
+	if err := m.checkWritable(); err != nil {
+		return err
+	}
+	for _, op := range b.ops {
+		if len(op.key) <= 0 {
+			return fmt.Errorf("Empty key")
+		}
+		if _, err := m.transform(op.key); err != nil {
+			return err
+		}
+	}
+
+	seq := uint64(0)
+	if m.wal != nil {
+		var err error
+		if seq, err = m.wal.logBatch(b); err != nil {
+			return fmt.Errorf("Cannot log batch: %s", err)
+		}
+	}
+
+	if err := m.applyBatch(b, keysLocked); err != nil {
+		if seq != 0 {
+			if aerr := m.wal.abort(seq); aerr != nil {
+				return errors.Join(err, fmt.Errorf("Cannot abort batch: %w", aerr))
+			}
+		}
+		return err
+	}
+
+	if seq != 0 {
+		m.wal.commit(seq)
+	}
+	return nil
+}
+
+// applyBatch applies the operations of the batch, see writeBatch for keysLocked
+func (m *Memoria) applyBatch(b *Batch, keysLocked bool) error {
+	for _, op := range b.ops {
+		var err error
+		switch {
+		case op.kind == walOpPut && keysLocked:
+			var pathKey *PathKey
+			if pathKey, err = m.transform(op.key); err == nil {
+				err = m.writeKeyLocked(pathKey, bytes.NewReader(op.val), false, m.walSync(), time.Time{})
+			}
+		case op.kind == walOpPut:
+			err = m.WriteStream(op.key, bytes.NewReader(op.val), false, m.walSync())
+		case keysLocked:
+			err = m.eraseKeyLocked(op.key)
+		default:
+			err = m.Erase(op.key)
+		}
+		if errors.Is(err, ErrKeyNotFound) && op.kind == walOpErase {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot apply batch to %s: %w", op.key, err)
+		}
+	}
+	return nil
+}
+
+// logPairs logs the valid pairs of a BulkWrite as one batch. Returns 0 without a log
+func (m *Memoria) logPairs(pairs map[string][]byte) (uint64, error) {
+	if m.wal == nil {
+		return 0, nil
+	}
+	b := &Batch{}
+	for key, val := range pairs {
+		// invalid keys fail on their own without failing the batch
+		if _, err := m.transform(key); len(key) > 0 && err == nil {
+			b.Put(key, val)
+		}
+	}
+	if b.Len() == 0 {
+		return 0, nil
+	}
+	seq, err := m.wal.logBatch(b)
+	if err != nil {
+		return 0, fmt.Errorf("Cannot log batch: %s", err)
+	}
+	return seq, nil
+}
+
+// walSync reports whether logged writes have to be synced before they are committed
+func (m *Memoria) walSync() bool {
+	return m.wal != nil && m.wal.policy == WALSyncAlways
+}
+
+// openWAL opens the write-ahead log of the store and applies every batch which was
+// logged but not committed before the last shutdown
+func (m *Memoria) openWAL() error {
+	dir := filepath.Join(m.Basedir, walDirName)
+	if err := m.FS.MkdirAll(dir, m.pathPerm); err != nil {
+		return fmt.Errorf("cannot create log directory: %w", err)
+	}
+
+	path := filepath.Join(dir, walFileName)
+	pending, err := readWAL(m.FS, path)
+	if err != nil {
+		return fmt.Errorf("cannot read log: %w", err)
+	}
+
+	for _, b := range pending {
+		if err := m.applyBatch(b, false); err != nil {
+			return fmt.Errorf("cannot replay log: %w", err)
+		}
+	}
+
+	f, err := m.FS.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, m.filePerm)
+	if err != nil {
+		return fmt.Errorf("cannot open log: %w", err)
+	}
+	// batches synced to a log whose directory entry is lost would never be replayed
+	if err := syncDir(m.FS, dir); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot sync log directory: %w", err)
+	}
+
+	w := &writeAheadLog{
+		fs:      m.FS,
+		path:    path,
+		perm:    m.filePerm,
+		f:       f,
+		policy:  m.WALSync,
+		pending: make(map[uint64]*pendingBatch),
+	}
+	if w.policy == WALSyncPeriodic {
+		period := m.WALSyncPeriod
+		if period <= 0 {
+			period = defaultWALSyncPeriod
+		}
+		w.startSyncer(period)
+	}
+	m.wal = w
+	return nil
+}
+
+// readWAL returns the batches of the log which have no commit or abort record. Reading stops at
+// the first torn or corrupt record, which is where a crash interrupted the log
+func readWAL(fsys FS, path string) ([]*Batch, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	batches := make(map[uint64]*Batch)
+	order := []uint64{}
+records:
+	for {
+		kind, seq, payload, err := readWALRecord(r)
+		if err != nil {
+			break
+		}
+		switch kind {
+		case walRecordBatch:
+			b, err := decodeBatch(payload)
+			if err != nil {
+				break records
+			}
+			batches[seq] = b
+			order = append(order, seq)
+		case walRecordCommit, walRecordAbort:
+			delete(batches, seq)
+		}
+	}
+
+	pending := []*Batch{}
+	for _, seq := range order {
+		if b, ok := batches[seq]; ok {
+			pending = append(pending, b)
+		}
+	}
+	return pending, nil
+}
+
+// writeAheadLog appends batch and commit records to the log file. Records are framed as
+// length, CRC-32C and body, the body being the record kind, sequence number and payload
+type writeAheadLog struct {
+	mu      sync.Mutex
+	fs      FS
+	path    string
+	perm    os.FileMode
+	f       File
+	policy  WALSyncPolicy
+	seq     uint64
+	size    int64                    // the size of the log file
+	pending map[uint64]*pendingBatch // batches logged but neither committed nor aborted
+	// pendingSize is the size of the records of the pending batches
+	pendingSize int64
+
+	stopSyncer chan struct{}
+	syncerDone chan struct{}
+}
+
+// pendingBatch is a batch in the log which is neither committed nor aborted
+type pendingBatch struct {
+	b    *Batch
+	size int64 // the size of its record
+}
+
+// logBatch appends the batch to the log and returns its sequence number
+func (w *writeAheadLog) logBatch(b *Batch) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.seq++
+	size := w.size
+	if err := w.append(walRecordBatch, w.seq, encodeBatch(b)); err != nil {
+		return 0, err
+	}
+	if w.policy == WALSyncAlways {
+		if err := w.f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	w.pending[w.seq] = &pendingBatch{b: b, size: w.size - size}
+	w.pendingSize += w.size - size
+	return w.seq, nil
+}
+
+// commit records that the batch was fully applied. Once no batch is pending the log is
+// truncated, and compacted while others are, so it never grows far beyond the batches in
+// flight
+func (w *writeAheadLog) commit(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// a lost commit record only makes Open apply the batch again
+	w.finish(walRecordCommit, seq)
+
+	// otherwise a batch replayed after a crash could overwrite later writes
+	if w.policy == WALSyncAlways {
+		w.f.Sync()
+	}
+}
+
+// abort records that the batch failed part way and must not be applied by Open. The
+// log is synced whatever the policy, the caller is told the batch failed and a replay
+// could overwrite the writes it makes afterwards
+func (w *writeAheadLog) abort(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// the batch is no longer pending even if the record is lost, so the log is still
+	// truncated once the batches in flight are done
+	if err := w.finish(walRecordAbort, seq); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// finish drops the batch from the pending ones, and truncates the log once none is left
+// or appends the record of kind otherwise. A log grown well beyond the pending batches is
+// compacted. The caller must hold mu
+func (w *writeAheadLog) finish(kind byte, seq uint64) error {
+	if p, ok := w.pending[seq]; ok {
+		w.pendingSize -= p.size
+		delete(w.pending, seq)
+	}
+	if len(w.pending) == 0 {
+		if err := w.f.Truncate(0); err == nil {
+			w.size = 0
+			_, err = w.f.Seek(0, io.SeekStart)
+			return err
+		}
+		// a failed truncate leaves finished batches in the log, which the record
+		// keeps from being applied again
+	}
+	if err := w.append(kind, seq, nil); err != nil {
+		return err
+	}
+	if w.size > max(walCompactSize, 2*w.pendingSize) {
+		// the log is still whole when it cannot be compacted, which is tried again
+		// once the next batch finishes
+		w.compact()
+	}
+	return nil
+}
+
+// compact replaces the log with one holding only the records of the pending batches. The
+// new log is synced before it is renamed over the old one, so a crash leaves either of
+// them in place. The caller must hold mu
+func (w *writeAheadLog) compact() error {
+	tmp := w.path + ".tmp"
+	f, err := w.fs.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, w.perm)
+	if err != nil {
+		return err
+	}
+	compacted := &writeAheadLog{f: f}
+	seqs := make([]uint64, 0, len(w.pending))
+	for seq := range w.pending {
+		seqs = append(seqs, seq)
+	}
+	// batches are applied again in the order they were logged
+	slices.Sort(seqs)
+	for _, seq := range seqs {
+		if err := compacted.append(walRecordBatch, seq, encodeBatch(w.pending[seq].b)); err != nil {
+			return cleanUp(w.fs, f, err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return cleanUp(w.fs, f, err)
+	}
+	if err := w.fs.Rename(tmp, w.path); err != nil {
+		return cleanUp(w.fs, f, err)
+	}
+	// the old log stays in place until the rename is durable
+	syncDir(w.fs, filepath.Dir(w.path))
+
+	w.f.Close()
+	w.f = f
+	w.size = compacted.size
+	return nil
+}
+
+func (w *writeAheadLog) append(kind byte, seq uint64, payload []byte) error {
+	body := make([]byte, 9+len(payload))
+	body[0] = kind
+	binary.LittleEndian.PutUint64(body[1:9], seq)
+	copy(body[9:], payload)
+
+	frame := make([]byte, 8, 8+len(body))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(body)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(body, crcTable))
+	frame = append(frame, body...)
+
+	n, err := w.f.Write(frame)
+	w.size += int64(n)
+	return err
+}
+
+func (w *writeAheadLog) startSyncer(period time.Duration) {
+	w.stopSyncer = make(chan struct{})
+	w.syncerDone = make(chan struct{})
+
+	go func() {
+		defer close(w.syncerDone)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.mu.Lock()
+				w.f.Sync()
+				w.mu.Unlock()
+			case <-w.stopSyncer:
+				return
+			}
+		}
+	}()
+}
+
+func (w *writeAheadLog) close() error {
+	if w.stopSyncer != nil {
+		close(w.stopSyncer)
+		<-w.syncerDone
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+func readWALRecord(r io.Reader) (kind byte, seq uint64, payload []byte, err error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size < 9 {
+		return 0, 0, nil, fmt.Errorf("short log record")
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	if crc32.Checksum(body, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+		return 0, 0, nil, fmt.Errorf("log record checksum mismatch")
+	}
+	return body[0], binary.LittleEndian.Uint64(body[1:9]), body[9:], nil
+}
+
+func encodeBatch(b *Batch) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(b.ops)))
+	for _, op := range b.ops {
+		buf = append(buf, op.kind)
+		buf = binary.AppendUvarint(buf, uint64(len(op.key)))
+		buf = append(buf, op.key...)
+		if op.kind == walOpPut {
+			buf = binary.AppendUvarint(buf, uint64(len(op.val)))
+			buf = append(buf, op.val...)
+		}
+	}
+	return buf
+}
+
+func decodeBatch(payload []byte) (*Batch, error) {
+	r := bytes.NewReader(payload)
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	readBytes := func() ([]byte, error) {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if size > uint64(r.Len()) {
+			return nil, fmt.Errorf("log record too short")
+		}
+		buf := make([]byte, size)
+		_, err = io.ReadFull(r, buf)
+		return buf, err
+	}
+
+	b := &Batch{}
+	for i := uint64(0); i < n; i++ {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		key, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		op := batchOp{kind: kind, key: string(key)}
+		switch kind {
+		case walOpPut:
+			if op.val, err = readBytes(); err != nil {
+				return nil, err
+			}
+		case walOpErase:
+		default:
+			return nil, fmt.Errorf("unknown log operation %d", kind)
+		}
+		b.ops = append(b.ops, op)
+	}
+	return b, nil
+}
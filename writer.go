@@ -0,0 +1,111 @@
+package memoria
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWriterClosed is returned when a Writer is used after Close or Abort
+var ErrWriterClosed = errors.New("writer is closed")
+
+// Writer streams a new value of a key into the store, see Create. A Writer is not
+// safe for concurrent use
+type Writer struct {
+	m      *Memoria
+	key    string
+	v      *stagedValue
+	unlock func()
+	err    error // the first failed write, returned by Close
+	closed bool
+}
+
+// Create returns a Writer for a new value of the key. Data written to it goes to a
+// temp file, compressed when the store has Compression, and the value is only
+// published when Close returns without error, replacing the old value and removing
+// its expiry. Abort discards the value instead.
+//
+// The Writer holds the lock of the key until it is closed or aborted, so other
+// writes to the same key wait for it while the rest of the store stays available.
+// Writing the same key from the goroutine holding the Writer deadlocks
+func (m *Memoria) Create(key string) (*Writer, error) {
+	if len(key) <= 0 {
+		return nil, fmt.Errorf("Empty key")
+	}
+
+	pathKey, err := m.transform(key)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := m.lockWrite(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	v, err := m.stageValue(pathKey)
+	m.mu.RUnlock()
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+
+	return &Writer{m: m, key: key, v: v, unlock: unlock}, nil
+}
+
+// Write writes p to the temp file of the value
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.v.dst.Write(p)
+	if err != nil {
+		w.err = fmt.Errorf("Cannot write value: %w", err)
+		return n, w.err
+	}
+	return n, nil
+}
+
+// Close publishes the value. If a write failed the value is discarded and the error
+// of the write is returned
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	defer w.unlock()
+
+	defer w.v.untrack()
+
+	if w.err != nil {
+		return w.v.abort(w.err)
+	}
+
+	if err := w.v.flush(false); err != nil {
+		return err
+	}
+
+	return w.m.publish(w.v, false, false, time.Time{})
+}
+
+// Abort discards the value and leaves the old one in place. Aborting a closed Writer
+// does nothing, so Abort can be deferred right after Create
+func (w *Writer) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.unlock()
+	defer w.v.untrack()
+
+	w.v.wc.Close()
+	w.v.f.Close()
+	if err := w.m.FS.Remove(w.v.f.Name()); err != nil {
+		return fmt.Errorf("Cannot remove temp file: %s", err)
+	}
+	return nil
+}